@@ -0,0 +1,168 @@
+package main
+
+import (
+	"image"
+	"math"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/vector"
+)
+
+// Empty pixels around every glyph, so that linear filtering doesn't bleed
+// the neighbouring glyphs in
+const atlasPadding = 1
+
+// GlyphAtlas is a single channel texture split into a grid of equally sized
+// cells, each of which holds the coverage of one glyph
+type GlyphAtlas struct {
+	Texture uint32
+	// Size of a cell in pixels, padding included
+	CellW, CellH int
+	Cols, Rows   int
+	// Cells not holding a glyph
+	free []int
+}
+
+// Creates an atlas with room for at least n glyphs of cellW by cellH pixels
+func NewGlyphAtlas(cellW, cellH, n int) *GlyphAtlas {
+	a := &GlyphAtlas{
+		CellW: cellW + 2*atlasPadding,
+		CellH: cellH + 2*atlasPadding,
+	}
+	a.Cols = int(math.Ceil(math.Sqrt(float64(n))))
+	if a.Cols == 0 {
+		a.Cols = 1
+	}
+	a.Rows = (n + a.Cols - 1) / a.Cols
+	if a.Rows == 0 {
+		a.Rows = 1
+	}
+	for i := a.Cols*a.Rows - 1; i >= 0; i-- {
+		a.free = append(a.free, i)
+	}
+	w, h := a.Cols*a.CellW, a.Rows*a.CellH
+	a.Texture = GLResources.GenTexture()
+	gl.BindTexture(gl.TEXTURE_2D, a.Texture)
+	// Rows of single byte pixels aren't aligned to 4 bytes
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
+	// New textures hold garbage, start with nothing covered
+	blank := make([]byte, w*h)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.R8, int32(w), int32(h), 0, gl.RED, gl.UNSIGNED_BYTE, gl.Ptr(blank))
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	// Sample as white with the coverage as alpha, so that the vertex color shows through
+	swizzle := []int32{gl.ONE, gl.ONE, gl.ONE, gl.RED}
+	gl.TexParameteriv(gl.TEXTURE_2D, gl.TEXTURE_SWIZZLE_RGBA, &swizzle[0])
+	return a
+}
+
+// Takes a free cell, ok is false if the atlas is full
+func (a *GlyphAtlas) Alloc() (cell int, ok bool) {
+	if len(a.free) == 0 {
+		return 0, false
+	}
+	cell = a.free[len(a.free)-1]
+	a.free = a.free[:len(a.free)-1]
+	return cell, true
+}
+
+// Gives the cell back, whatever is in it may be overwritten from now on
+func (a *GlyphAtlas) Release(cell int) {
+	a.free = append(a.free, cell)
+}
+
+// Copies the coverage in img into the cell, img must fit in it without the padding
+func (a *GlyphAtlas) Put(cell int, img *image.Alpha) {
+	size := img.Bounds().Size()
+	if size.X == 0 || size.Y == 0 {
+		return
+	}
+	x, y := a.origin(cell)
+	gl.BindTexture(gl.TEXTURE_2D, a.Texture)
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
+	gl.PixelStorei(gl.UNPACK_ROW_LENGTH, int32(img.Stride))
+	gl.TexSubImage2D(gl.TEXTURE_2D, 0, int32(x), int32(y), int32(size.X), int32(size.Y), gl.RED, gl.UNSIGNED_BYTE, gl.Ptr(img.Pix))
+	gl.PixelStorei(gl.UNPACK_ROW_LENGTH, 0)
+}
+
+// Top left pixel of the cell, past the padding
+func (a *GlyphAtlas) origin(cell int) (x, y int) {
+	return (cell%a.Cols)*a.CellW + atlasPadding, (cell/a.Cols)*a.CellH + atlasPadding
+}
+
+// Returns the texture coords of the pixel x, y of the glyph in cell
+func (a *GlyphAtlas) UV(cell int, x, y float32) (u, v float32) {
+	ox, oy := a.origin(cell)
+	return (float32(ox) + x) / float32(a.Cols*a.CellW), (float32(oy) + y) / float32(a.Rows*a.CellH)
+}
+
+func (a *GlyphAtlas) Free() {
+	GLResources.DeleteTexture(&a.Texture)
+}
+
+// Returns the pixel bounds of the outline, rounded out to whole pixels
+// The control points of curves are included, so it can be a bit too big
+func segmentsBounds(segs []sfnt.Segment) image.Rectangle {
+	if len(segs) == 0 {
+		return image.Rectangle{}
+	}
+	minX, minY := segs[0].Args[0].X, segs[0].Args[0].Y
+	maxX, maxY := minX, minY
+	for _, seg := range segs {
+		n := 1
+		switch seg.Op {
+		case sfnt.SegmentOpQuadTo:
+			n = 2
+		case sfnt.SegmentOpCubeTo:
+			n = 3
+		}
+		for _, arg := range seg.Args[:n] {
+			if arg.X < minX {
+				minX = arg.X
+			}
+			if arg.Y < minY {
+				minY = arg.Y
+			}
+			if arg.X > maxX {
+				maxX = arg.X
+			}
+			if arg.Y > maxY {
+				maxY = arg.Y
+			}
+		}
+	}
+	return image.Rect(minX.Floor(), minY.Floor(), maxX.Ceil(), maxY.Ceil())
+}
+
+// Rasterizes the outline into its coverage, with anti aliased edges
+// The image covers bounds, which is in the same pixels as the segments
+func rasterizeGlyph(segs []sfnt.Segment, bounds image.Rectangle) *image.Alpha {
+	size := bounds.Size()
+	img := image.NewAlpha(image.Rect(0, 0, size.X, size.Y))
+	if size.X == 0 || size.Y == 0 {
+		return img
+	}
+	r := vector.NewRasterizer(size.X, size.Y)
+	ox, oy := float32(bounds.Min.X), float32(bounds.Min.Y)
+	for _, seg := range segs {
+		a := seg.Args
+		// 26.6 fixed point to pixels relative to the image
+		x := func(i int) float32 { return float32(a[i].X)/64 - ox }
+		y := func(i int) float32 { return float32(a[i].Y)/64 - oy }
+		switch seg.Op {
+		case sfnt.SegmentOpMoveTo:
+			r.MoveTo(x(0), y(0))
+		case sfnt.SegmentOpLineTo:
+			r.LineTo(x(0), y(0))
+		case sfnt.SegmentOpQuadTo:
+			r.QuadTo(x(0), y(0), x(1), y(1))
+		case sfnt.SegmentOpCubeTo:
+			r.CubeTo(x(0), y(0), x(1), y(1), x(2), y(2))
+		}
+	}
+	r.Draw(img, img.Bounds(), image.Opaque, image.Point{})
+	return img
+}
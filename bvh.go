@@ -0,0 +1,287 @@
+package main
+
+import (
+	"math"
+	"sort"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Max number of shapes in a leaf of the BVH
+const bvhLeafSize = 4
+
+// Axis aligned bounding box
+type AABB struct {
+	Min, Max mgl32.Vec3
+}
+
+// Returns the smallest box containing all of the vectors, or an empty box
+// which contains nothing if there are none
+func NewAABB(vecs ...mgl32.Vec3) AABB {
+	inf := float32(math.Inf(1))
+	b := AABB{mgl32.Vec3{inf, inf, inf}, mgl32.Vec3{-inf, -inf, -inf}}
+	for _, v := range vecs {
+		b = b.Add(v)
+	}
+	return b
+}
+
+func (b AABB) Empty() bool {
+	return b.Min[0] > b.Max[0] || b.Min[1] > b.Max[1] || b.Min[2] > b.Max[2]
+}
+
+// Returns the box grown to contain v
+func (b AABB) Add(v mgl32.Vec3) AABB {
+	for i := range v {
+		if v[i] < b.Min[i] {
+			b.Min[i] = v[i]
+		}
+		if v[i] > b.Max[i] {
+			b.Max[i] = v[i]
+		}
+	}
+	return b
+}
+
+// Returns the smallest box containing both b and o
+func (b AABB) Union(o AABB) AABB {
+	if o.Empty() {
+		return b
+	}
+	return b.Add(o.Min).Add(o.Max)
+}
+
+func (b AABB) Overlaps(o AABB) bool {
+	for i := 0; i < 3; i++ {
+		if b.Max[i] < o.Min[i] || o.Max[i] < b.Min[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (b AABB) Center() mgl32.Vec3 {
+	return b.Min.Add(b.Max).Mul(0.5)
+}
+
+// Returns the box around b after transforming it by m
+func (b AABB) Transform(m mgl32.Mat4) AABB {
+	if b.Empty() {
+		return b
+	}
+	if m.Row(3) == (mgl32.Vec4{0, 0, 0, 1}) {
+		// Affine, so each axis of the result is the translation plus the
+		// smaller and larger ends of every column scaled by the box (Arvo's method)
+		t := AABB{m.Col(3).Vec3(), m.Col(3).Vec3()}
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				lo, hi := m.At(i, j)*b.Min[j], m.At(i, j)*b.Max[j]
+				if lo > hi {
+					lo, hi = hi, lo
+				}
+				t.Min[i] += lo
+				t.Max[i] += hi
+			}
+		}
+		return t
+	}
+	t := NewAABB()
+	for i := 0; i < 8; i++ {
+		corner := b.Min
+		for axis := 0; axis < 3; axis++ {
+			if i&(1<<axis) != 0 {
+				corner[axis] = b.Max[axis]
+			}
+		}
+		t = t.Add(mgl32.TransformCoordinate(corner, m))
+	}
+	return t
+}
+
+// Returns how far along dir the ray from origin enters the box
+func (b AABB) Ray(origin, dir mgl32.Vec3) (float32, bool) {
+	if b.Empty() {
+		return 0, false
+	}
+	return RayBoxCollision(origin, dir, b.Min, b.Max)
+}
+
+// A shape placed in the world, as stored in the BVH
+type BVHItem struct {
+	Node  *Node
+	Shape *Shape
+	// What the shape is drawn at, without its own ModelMat
+	Parent mgl32.Mat4
+	Box    AABB
+	// Center of Box, the items are split by it
+	center mgl32.Vec3
+}
+
+type bvhNode struct {
+	Box         AABB
+	Left, Right *bvhNode
+	// Only leaves have items
+	Items []*BVHItem
+}
+
+// Bounding volume hierarchy over shapes, so that ray and box queries only
+// look at the shapes near them instead of all of them
+type BVH struct {
+	root *bvhNode
+}
+
+func NewBVH(items []*BVHItem) *BVH {
+	if len(items) == 0 {
+		return &BVH{}
+	}
+	for _, it := range items {
+		it.center = it.Box.Center()
+	}
+	return &BVH{buildBVH(items)}
+}
+
+// Splits the items at the middle of the longest axis of their centers, or
+// in half if they all fall on one side of it
+func buildBVH(items []*BVHItem) *bvhNode {
+	n := &bvhNode{Box: NewAABB()}
+	centers := NewAABB()
+	for _, it := range items {
+		n.Box = n.Box.Union(it.Box)
+		centers = centers.Add(it.center)
+	}
+	if len(items) <= bvhLeafSize {
+		n.Items = items
+		return n
+	}
+	axis := 0
+	size := centers.Max.Sub(centers.Min)
+	if size[1] > size[axis] {
+		axis = 1
+	}
+	if size[2] > size[axis] {
+		axis = 2
+	}
+	split := centers.Center()[axis]
+	mid := 0
+	for i, it := range items {
+		if it.center[axis] < split {
+			items[i], items[mid] = items[mid], items[i]
+			mid++
+		}
+	}
+	if mid == 0 || mid == len(items) {
+		sort.Slice(items, func(i, j int) bool {
+			return items[i].center[axis] < items[j].center[axis]
+		})
+		mid = len(items) / 2
+	}
+	n.Left = buildBVH(items[:mid])
+	n.Right = buildBVH(items[mid:])
+	return n
+}
+
+// Calls visit for every item whose box the ray from origin along dir enters,
+// nearest box first, visit returns the distance up to which it still wants
+// items, so that far away parts of the tree are skipped
+func (b *BVH) Ray(origin, dir mgl32.Vec3, visit func(it *BVHItem, t float32) float32) {
+	if b.root == nil {
+		return
+	}
+	maxT := float32(math.Inf(1))
+	b.root.ray(origin, dir, &maxT, visit)
+}
+
+func (n *bvhNode) ray(origin, dir mgl32.Vec3, maxT *float32, visit func(it *BVHItem, t float32) float32) {
+	if t, ok := n.Box.Ray(origin, dir); !ok || t > *maxT {
+		return
+	}
+	if n.Items != nil {
+		type entry struct {
+			it *BVHItem
+			t  float32
+		}
+		var entries []entry
+		for _, it := range n.Items {
+			if t, ok := it.Box.Ray(origin, dir); ok {
+				entries = append(entries, entry{it, t})
+			}
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].t < entries[j].t })
+		for _, e := range entries {
+			if e.t > *maxT {
+				return
+			}
+			if t := visit(e.it, e.t); t < *maxT {
+				*maxT = t
+			}
+		}
+		return
+	}
+	// Go into the nearer child first, so the further one can be skipped more often
+	first, second := n.Left, n.Right
+	tl, okl := n.Left.Box.Ray(origin, dir)
+	tr, okr := n.Right.Box.Ray(origin, dir)
+	if okr && (!okl || tr < tl) {
+		first, second = second, first
+	}
+	first.ray(origin, dir, maxT, visit)
+	second.ray(origin, dir, maxT, visit)
+}
+
+// Returns every item whose box overlaps box
+func (b *BVH) Overlapping(box AABB) []*BVHItem {
+	var found []*BVHItem
+	if b.root != nil {
+		b.root.overlapping(box, &found)
+	}
+	return found
+}
+
+func (n *bvhNode) overlapping(box AABB, found *[]*BVHItem) {
+	if !n.Box.Overlaps(box) {
+		return
+	}
+	for _, it := range n.Items {
+		if it.Box.Overlaps(box) {
+			*found = append(*found, it)
+		}
+	}
+	if n.Left != nil {
+		n.Left.overlapping(box, found)
+		n.Right.overlapping(box, found)
+	}
+}
+
+// Returns a BVH over every visible shape in the scene, it is built on the
+// first call after Invalidate and reused by every query until the next one
+func (s *Scene) BVH() *BVH {
+	if s.bvh == nil {
+		var items []*BVHItem
+		s.collect(s.Root, mgl32.Ident4(), &items)
+		s.bvh = NewBVH(items)
+	}
+	return s.bvh
+}
+
+func (s *Scene) collect(n *Node, parent mgl32.Mat4, items *[]*BVHItem) {
+	if n.Hidden {
+		return
+	}
+	model := parent.Mul4(n.Transform)
+	var shapes []*Shape
+	switch d := n.D.(type) {
+	case *Shape:
+		shapes = []*Shape{d}
+	case *Button:
+		shapes = []*Shape{d.Geometry, d.TextShape}
+	}
+	for _, shape := range shapes {
+		// Shapes without points can't be hit by anything
+		if box := shape.WorldBounds(model); !box.Empty() {
+			*items = append(*items, &BVHItem{Node: n, Shape: shape, Parent: model, Box: box})
+		}
+	}
+	for _, c := range n.Children {
+		s.collect(c, model, items)
+	}
+}
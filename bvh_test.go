@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func TestAABBTransform(t *testing.T) {
+	box := NewAABB(mgl32.Vec3{-1, 0, 2}, mgl32.Vec3{3, 1, 4})
+	mats := []mgl32.Mat4{
+		mgl32.Ident4(),
+		mgl32.Translate3D(1, -2, 3),
+		mgl32.Scale3D(2, -1, 0.5),
+		mgl32.Translate3D(1, 2, 3).Mul4(mgl32.HomogRotate3D(0.7, mgl32.Vec3{1, 2, 3}.Normalize())).Mul4(mgl32.Scale3D(1, 3, -2)),
+		// Not affine, so the corners are projected
+		mgl32.Perspective(1, 1, 0.1, 10),
+	}
+	for i, m := range mats {
+		want := NewAABB()
+		for c := 0; c < 8; c++ {
+			corner := box.Min
+			for axis := 0; axis < 3; axis++ {
+				if c&(1<<axis) != 0 {
+					corner[axis] = box.Max[axis]
+				}
+			}
+			want = want.Add(mgl32.TransformCoordinate(corner, m))
+		}
+		got := box.Transform(m)
+		if !got.Min.ApproxEqualThreshold(want.Min, 1e-5) || !got.Max.ApproxEqualThreshold(want.Max, 1e-5) {
+			t.Errorf("matrix %d: box transformed to %v, want %v", i, got, want)
+		}
+	}
+	if !NewAABB().Transform(mgl32.Translate3D(1, 1, 1)).Empty() {
+		t.Error("an empty box is not empty after being transformed")
+	}
+}
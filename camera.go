@@ -0,0 +1,95 @@
+package main
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Projection modes of a Camera
+const (
+	PROJ_PERSPECTIVE = iota
+	PROJ_ORTHOGRAPHIC
+)
+
+// Camera is where a scene is looked at from and how it is projected
+type Camera struct {
+	Eye    mgl32.Vec3
+	Target mgl32.Vec3
+	Up     mgl32.Vec3
+	// PROJ_PERSPECTIVE or PROJ_ORTHOGRAPHIC
+	Mode int
+	// Vertical field of view in degrees, used in PROJ_PERSPECTIVE
+	Fov float32
+	// Half of the height of the visible area, used in PROJ_ORTHOGRAPHIC
+	Height float32
+	// Distance of the clipping planes from the eye
+	Near, Far float32
+	// Width of the viewport divided by its height
+	Aspect float32
+}
+
+// Returns a perspective camera at eye looking at target
+func NewCamera(eye, target mgl32.Vec3) *Camera {
+	return &Camera{
+		Eye:    eye,
+		Target: target,
+		Up:     mgl32.Vec3{0, 1, 0},
+		Mode:   PROJ_PERSPECTIVE,
+		Fov:    120,
+		Height: 1,
+		Near:   0.001,
+		Far:    viewRange,
+		Aspect: 1,
+	}
+}
+
+// Returns an orthographic camera looking down at center diagonally, from the
+// corner where x, y and z are the largest, size is the largest distance from
+// center that should be visible, for eg. half the diagonal of the grid
+func NewIsoCamera(center mgl32.Vec3, size float32) *Camera {
+	c := NewCamera(center.Add(mgl32.Vec3{1, 1, 1}.Normalize().Mul(2*size)), center)
+	c.Mode = PROJ_ORTHOGRAPHIC
+	c.Height = size
+	c.Near = 0
+	c.Far = 4 * size
+	return c
+}
+
+// Returns an orthographic camera looking straight down at the XY plane, y goes
+// from -1 at the bottom of the screen to 1 at the top and x as far as the
+// aspect ratio lets it, used for things drawn over the screen like the HUD
+func NewOverlayCamera() *Camera {
+	c := NewCamera(mgl32.Vec3{0, 0, 2}, mgl32.Vec3{0, 0, 0})
+	c.Mode = PROJ_ORTHOGRAPHIC
+	c.Height = 1
+	c.Near = 0
+	c.Far = 4
+	return c
+}
+
+func (c *Camera) View() mgl32.Mat4 {
+	return mgl32.LookAtV(c.Eye, c.Target, c.Up)
+}
+
+func (c *Camera) Proj() mgl32.Mat4 {
+	switch c.Mode {
+	case PROJ_ORTHOGRAPHIC:
+		return mgl32.Ortho(-c.Height*c.Aspect, c.Height*c.Aspect, -c.Height, c.Height, c.Near, c.Far)
+	default:
+		return mgl32.Perspective(mgl32.DegToRad(c.Fov), c.Aspect, c.Near, c.Far)
+	}
+}
+
+// Keeps the aspect ratio in sync with the framebuffer
+func (c *Camera) Resize(width, height int) {
+	if height == 0 {
+		// Minimized windows have no height
+		return
+	}
+	c.Aspect = float32(width) / float32(height)
+}
+
+// Sets the projection and view uniforms of prog
+func (c *Camera) Apply(prog *Program) {
+	prog.Mat4("projection", c.Proj())
+	prog.Mat4("view", c.View())
+}
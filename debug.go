@@ -0,0 +1,7 @@
+//go:build debug
+// +build debug
+
+package main
+
+// Built with `make debug`, enables leak reports and other checks
+const debugBuild = true
@@ -4,10 +4,23 @@ in vec4 Col;
 in vec3 Nor;
 in vec2 TexCoords;
 flat in float Threshold;
+uniform vec4 tint;
+uniform bool lighting;
+uniform bool textured;
+uniform sampler2D tex;
+out vec4 FragColor;
 void main() {
 	vec4 color;
-	color = Col;
+	color = Col * tint;
 	float dotprod = length(TexCoords);
 	color = color; /* * (-atan(16*(dotprod - Threshold)/(1-Threshold))/PI + 0.5); */
-	gl_FragColor = color;
+	if (textured) {
+		color *= texture(tex, TexCoords);
+	}
+	if (lighting) {
+		// Light coming from over the right shoulder of the viewer
+		vec3 lightDir = normalize(vec3(0.5, 1.0, 1.0));
+		color.rgb *= 0.3 + 0.7 * max(dot(normalize(Nor), lightDir), 0.0);
+	}
+	FragColor = color;
 }
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	// Height of a line of HUD text, in halves of the screen height
+	hudTextSize = 0.06
+	// Space between the HUD and the edges of the screen, and around the text
+	hudMargin = 0.03
+	// Rates are averaged over this long
+	rateWindow = time.Second
+)
+
+// RateMeter counts how many times something happens per second
+type RateMeter struct {
+	times []time.Time
+}
+
+// Records that it happened at now
+func (r *RateMeter) Tick(now time.Time) {
+	r.times = append(r.times, now)
+	r.forget(now)
+}
+
+// Returns how many times it happened per second, over the last rateWindow before now
+func (r *RateMeter) Rate(now time.Time) float64 {
+	r.forget(now)
+	return float64(len(r.times)) / rateWindow.Seconds()
+}
+
+func (r *RateMeter) forget(now time.Time) {
+	old := 0
+	for old < len(r.times) && now.Sub(r.times[old]) > rateWindow {
+		old++
+	}
+	r.times = r.times[old:]
+}
+
+// HUD shows how the game is going in the top left corner, over the game
+type HUD struct {
+	Scene   *Scene
+	Font    *Font
+	Visible bool
+	// Backdrop keeping the text readable over the game
+	panel *Shape
+	text  *Shape
+	node  *Node
+	// What the text shape shows, it is only laid out again when this changes
+	shown     string
+	evictions int
+	start     time.Time
+	// Length of the snake in the first frame, every food eaten after that scores a point
+	startLen int
+	ticks    RateMeter
+	frames   RateMeter
+}
+
+func NewHUD(font *Font) *HUD {
+	h := &HUD{
+		Scene:    NewScene(NewOverlayCamera()),
+		Font:     font,
+		Visible:  true,
+		startLen: -1,
+		start:    time.Now(),
+	}
+	h.panel = NewShape(mgl32.Ident4(), DefaultMaterial)
+	h.panel.SetUsage(gl.DYNAMIC_DRAW)
+	h.text = NewShape(mgl32.Ident4(), font.Material)
+	h.text.SetTypes(gl.TRIANGLES)
+	h.text.SetUsage(gl.DYNAMIC_DRAW)
+	h.node = NewNode(mgl32.Ident4(), nil, NewNode(mgl32.Ident4(), h.panel), NewNode(mgl32.Ident4(), h.text))
+	h.Scene.Root.Add(h.node)
+	return h
+}
+
+// Call this with every frame received from the server
+func (h *HUD) Tick(f Frame) {
+	if h.startLen == -1 {
+		h.startLen = len(f.Snake)
+	}
+	h.ticks.Tick(time.Now())
+}
+
+// Starts counting the time and the score again, for a new game
+func (h *HUD) Reset() {
+	h.start = time.Now()
+	h.startLen = -1
+	h.ticks = RateMeter{}
+}
+
+func (h *HUD) Toggle() {
+	h.Visible = !h.Visible
+}
+
+// Counts the frame as drawn and draws the HUD over whatever was drawn, if visible
+func (h *HUD) Draw(f Frame) {
+	now := time.Now()
+	h.frames.Tick(now)
+	if !h.Visible {
+		return
+	}
+	score := 0
+	if h.startLen != -1 {
+		score = len(f.Snake) - h.startLen
+	}
+	elapsed := now.Sub(h.start).Truncate(time.Second)
+	h.setText(fmt.Sprintf("Score: %d\nLength: %d\nTime: %s\nTick rate: %.1f/s\nFPS: %.0f",
+		score, len(f.Snake), elapsed, h.ticks.Rate(now), h.frames.Rate(now)))
+	// Stick to the top left corner, wherever it is after resizing
+	cam := h.Scene.Camera
+	h.node.Transform = mgl32.Translate3D(-cam.Height*cam.Aspect+hudMargin, cam.Height-hudMargin, 0).
+		Mul4(mgl32.Scale3D(hudTextSize, hudTextSize, 1))
+	h.Scene.Draw()
+}
+
+// Lays out s again if it isn't already shown
+func (h *HUD) setText(s string) {
+	// Glyphs being dropped from the atlas can leave the old text showing the wrong ones
+	if s == h.shown && h.Font.Evictions == h.evictions {
+		return
+	}
+	h.shown, h.evictions = s, h.Font.Evictions
+	layout := h.Font.Layout(s, TextOptions{})
+	h.text.Pts = h.Font.LayoutToShape(layout).Pts
+	h.text.Update()
+	// In ems, like the text
+	pad := float32(hudMargin / hudTextSize)
+	b := layout.Bounds
+	h.panel.Pts = []*Point{
+		PC(b.Min.X()-pad, b.Max.Y()+pad, 1, 0, 0, 0, 0.5),
+		PC(b.Min.X()-pad, b.Min.Y()-pad, 1, 0, 0, 0, 0.5),
+		PC(b.Max.X()+pad, b.Max.Y()+pad, 1, 0, 0, 0, 0.5),
+		PC(b.Max.X()+pad, b.Min.Y()-pad, 1, 0, 0, 0, 0.5),
+	}
+	h.panel.SetTypes(gl.TRIANGLE_STRIP)
+	h.panel.Update()
+}
+
+func (h *HUD) Free() {
+	h.panel.Free()
+	h.text.Free()
+}
@@ -2,62 +2,45 @@ package main
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/go-gl/glfw/v3.3/glfw"
 	"github.com/go-gl/mathgl/mgl32"
 )
 
-func HandleKeys(w *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+// Sends the move for key to the server, Escape is handled by Client.HandleKey
+func HandleKeys(w *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) error {
+	cmd := byte('F')
 	switch key {
-	case glfw.KeyEscape:
-		outputFile.Write([]byte{byte('E')})
-		w.SetShouldClose(true)
-		w.Destroy()
-		os.Exit(0)
 	case glfw.KeyUp:
-		outputFile.Write([]byte{byte('x')})
+		cmd = byte('x')
 	case glfw.KeyDown:
-
-		outputFile.Write([]byte{byte('X')})
-
+		cmd = byte('X')
 	case glfw.KeyRight:
-
-		outputFile.Write([]byte{byte('z')})
-
+		cmd = byte('z')
 	case glfw.KeyLeft:
-
-		outputFile.Write([]byte{byte('Z')})
-
+		cmd = byte('Z')
 	case glfw.KeySpace:
-
-		outputFile.Write([]byte{byte('y')})
-
+		cmd = byte('y')
 	case glfw.KeyZ:
-
-		outputFile.Write([]byte{byte('Y')})
-	default:
-		outputFile.Write([]byte{byte('F')})
+		cmd = byte('Y')
 	}
-	Snake, Food = NextFrame()
-	fmt.Fprintf(os.Stderr, "Snake: %+v, Food: %+v", Snake, Food)
+	_, err := outputFile.Write([]byte{cmd})
+	return err
 }
 
-func HandleMouseMovement(w *glfw.Window, xpos, ypos float64) {
-	width, height := w.GetFramebufferSize()
-	CurrPoint[0] = float32(2*xpos/float64(width) - 1)
-	CurrPoint[1] = -float32(2*ypos/float64(height) - 1)
-	switch BtnState {
-	case byte('P'):
-
-	case byte('C'):
-		LookAt = mgl32.Rotate3DX(CurrPoint[1]).Mul3(mgl32.Rotate3DY(CurrPoint[0])).Mul3x1(mgl32.Vec3{0, 0, -1}).Normalize().Add(eyePos)
-		UpdateView(
-			LookAt,
-			eyePos,
-		)
+// Returns a cursor callback which turns cam to look where the mouse points
+func HandleMouseMovement(cam *Camera) glfw.CursorPosCallback {
+	return func(w *glfw.Window, xpos, ypos float64) {
+		width, height := w.GetFramebufferSize()
+		CurrPoint[0] = float32(2*xpos/float64(width) - 1)
+		CurrPoint[1] = -float32(2*ypos/float64(height) - 1)
+		switch BtnState {
+		case byte('P'):
+
+		case byte('C'):
+			cam.Target = mgl32.Rotate3DX(CurrPoint[1]).Mul3(mgl32.Rotate3DY(CurrPoint[0])).Mul3x1(mgl32.Vec3{0, 0, -1}).Normalize().Add(cam.Eye)
+		}
 	}
-
 }
 
 func HandleMouseButton(w *glfw.Window, button glfw.MouseButton, action glfw.Action, mods glfw.ModifierKey) {
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"math"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// A single float attribute of a vertex
+type VertexAttrib struct {
+	// Name of the input in the vertex shader
+	Name string
+	// Number of float32 components
+	Size int32
+	// Returns the components of the attribute for the given point
+	Get func(p *Point) []float32
+}
+
+// VertexLayout describes how Points are packed into a Vbo and how the
+// shader reads them back, attribute i is at location i
+type VertexLayout []VertexAttrib
+
+// The layout of every Point drawn by the client
+var PointLayout = VertexLayout{
+	{"aPos", 3, func(p *Point) []float32 { return p.P[:] }},
+	{"aCol", 4, func(p *Point) []float32 { return p.C[:] }},
+	{"aNor", 3, func(p *Point) []float32 { return p.N[:] }},
+	{"aTex", 2, func(p *Point) []float32 { return p.T[:] }},
+	{"thresholdIn", 1, func(p *Point) []float32 { return []float32{p.Threshold} }},
+}
+
+// Size of a single vertex in bytes
+func (l VertexLayout) Stride() int32 {
+	stride := int32(0)
+	for _, a := range l {
+		stride += a.Size * 4
+	}
+	return stride
+}
+
+// Offset of the ith attribute from the start of a vertex in bytes
+func (l VertexLayout) Offset(i int) int {
+	offset := 0
+	for _, a := range l[:i] {
+		offset += int(a.Size) * 4
+	}
+	return offset
+}
+
+// Packs the points into bytes in the native byte order,
+// the result is always Stride()*len(pts) bytes long
+func (l VertexLayout) Pack(pts []*Point) []byte {
+	stride := int(l.Stride())
+	data := make([]byte, stride*len(pts))
+	for i, p := range pts {
+		n := i * stride
+		for _, a := range l {
+			comps := a.Get(p)
+			for j := int32(0); j < a.Size; j++ {
+				endianness.PutUint32(data[n:n+4], math.Float32bits(comps[j]))
+				n += 4
+			}
+		}
+	}
+	return data
+}
+
+// Points the attributes of the currently bound Vao at the currently bound Vbo
+func (l VertexLayout) Enable() {
+	stride := l.Stride()
+	for i, a := range l {
+		gl.EnableVertexAttribArray(uint32(i))
+		gl.VertexAttribPointer(uint32(i), a.Size, gl.FLOAT, false, stride, gl.PtrOffset(l.Offset(i)))
+	}
+}
+
+// Creates a Vbo filled with data and a Vao reading it through the layout
+func (l VertexLayout) GenVao(data []byte, usage uint32) (vao, vbo uint32) {
+	// Generate the buffer for the Vertex data
+	vbo = GLResources.GenBuffer()
+	gl.BindBuffer(gl.ARRAY_BUFFER, vbo)
+	gl.BufferData(gl.ARRAY_BUFFER, len(data), bytesPtr(data), usage)
+	// Generate our Vertex Array
+	vao = GLResources.GenVertexArray()
+	gl.BindVertexArray(vao)
+	gl.BindBuffer(gl.ARRAY_BUFFER, vbo)
+	l.Enable()
+	return vao, vbo
+}
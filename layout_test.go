@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func testPoints() []*Point {
+	return []*Point{
+		PC(1, 2, 3, 0.1, 0.2, 0.3, 0.4),
+		PCN(-1, -2, -3, 1, 0, 0, 1, 0, 1, 0),
+		{P: [3]float32{4, 5, 6}, C: [4]float32{1, 1, 1, 1}, T: [2]float32{0.25, 0.75}, Threshold: 1},
+	}
+}
+
+func TestPackSize(t *testing.T) {
+	endianness = binary.LittleEndian
+	pts := testPoints()
+	for n := 0; n <= len(pts); n++ {
+		data := PointLayout.Pack(pts[:n])
+		if want := int(PointLayout.Stride()) * n; len(data) != want {
+			t.Errorf("Pack of %d points is %d bytes, want stride %d * %d = %d",
+				n, len(data), PointLayout.Stride(), n, want)
+		}
+	}
+}
+
+func TestPackOffsets(t *testing.T) {
+	endianness = binary.LittleEndian
+	pts := testPoints()
+	data := PointLayout.Pack(pts)
+	stride := int(PointLayout.Stride())
+	for v, p := range pts {
+		for i, a := range PointLayout {
+			comps := a.Get(p)
+			if int32(len(comps)) != a.Size {
+				t.Fatalf("%s has %d components, layout says %d", a.Name, len(comps), a.Size)
+			}
+			at := v*stride + PointLayout.Offset(i)
+			for j, want := range comps {
+				got := math.Float32frombits(endianness.Uint32(data[at+j*4:]))
+				if got != want {
+					t.Errorf("vertex %d %s[%d] at offset %d = %v, want %v",
+						v, a.Name, j, at+j*4, got, want)
+				}
+			}
+		}
+	}
+}
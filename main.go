@@ -2,14 +2,14 @@ package main
 
 import (
 	"encoding/binary"
+	"flag"
 	"fmt"
 	"github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/go-gl/glfw/v3.3/glfw"
 	"github.com/go-gl/mathgl/mgl32"
-	"golang.org/x/sys/unix"
 	"image"
 	"image/png"
-	"io/ioutil"
+	"io"
 	"os"
 	"runtime"
 	"time"
@@ -17,6 +17,7 @@ import (
 )
 
 const (
+	title     = "Snek3D-Frontend"
 	W         = 500
 	H         = 500
 	fps       = time.Second / 2
@@ -38,28 +39,18 @@ const (
 	// they will be intersecting [{0, 1}, {13, 23}] and [{23, 24}, {1, 23}]
 	// respectively
 	RAY_TYPE_STRIP = 0x1
-	pointByteSize  = int32(13 * 4)
 )
 
 var (
-	viewMat                         mgl32.Mat4
-	projMat                         mgl32.Mat4
-	defaultViewMat                  mgl32.Mat4
 	AddState                        byte
-	program                         uint32
 	MouseX                          float64
 	MouseY                          float64
 	CurrPoint                       mgl32.Vec2
-	Btns                            []*Button
 	BtnState                        = byte('C')
-	eyePos                          mgl32.Vec3
-	LookAt                          mgl32.Vec3
 	MouseRay                        *Ray
 	framesDrawn                     int
 	Ident                           = mgl32.Ident4()
 	endianness                      binary.ByteOrder
-	Snake                           []mgl32.Vec3
-	Food                            mgl32.Vec3
 	inputFile                       *os.File
 	outputFile                      *os.File
 	coordBytes                      []byte
@@ -70,28 +61,26 @@ var (
 )
 
 func main() {
-	inputName := os.Args[1]
-	outputName := os.Args[2]
-	inputFile = os.Stdin
-	outputFile = os.Stdout
-	var err error
-	if inputName != "-" {
-		os.Stderr.WriteString(inputName)
-		os.Stderr.WriteString("is the input \n")
-		os.Remove(inputName)
-		err = unix.Mkfifo(inputName, 0666)
-		orDie(err)
-		inputFile, err = os.OpenFile(inputName, os.O_RDONLY, os.ModeNamedPipe)
-		os.Stderr.WriteString("Reached Here? \n")
-		orDie(err)
+	force := flag.Bool("force", false, "replace files which are in the way of the FIFOs")
+	wait := flag.Bool("wait", false, "wait for the server to create the FIFOs instead of creating them")
+	timeout := flag.Duration("timeout", 30*time.Second, "how long to wait for the server to create and open the FIFOs, 0 for ever")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] input output\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "input and output are FIFOs, or - for stdin and stdout")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
 	}
-	if outputName != "-" {
-		os.Stderr.WriteString(outputName)
-		os.Stderr.WriteString("is the output \n")
-		os.Remove(outputName)
-		err = unix.Mkfifo(outputName, 0666)
-		orDie(err)
-		outputFile, err = os.OpenFile(outputName, os.O_WRONLY, os.ModeNamedPipe)
+	HandleSignals()
+	// Runs last, after everything using GL is freed and glfw is terminated
+	defer CloseTransport()
+	if err := OpenTransport(flag.Arg(0), flag.Arg(1), *force, !*wait, *timeout); err != nil {
+		CloseTransport()
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 	buf := [2]byte{}
 	*(*uint16)(unsafe.Pointer(&buf[0])) = uint16(0xABCD)
@@ -116,7 +105,7 @@ func main() {
 	glfw.WindowHint(glfw.OpenGLProfile, glfw.OpenGLCoreProfile)
 	glfw.WindowHint(glfw.OpenGLForwardCompatible, glfw.True)
 	// Create the window with the above hints
-	window, err := glfw.CreateWindow(W, H, "Snek3D-Frontend", nil, nil)
+	window, err := glfw.CreateWindow(W, H, title, nil, nil)
 	orDie(err)
 	window.Focus()
 	window.Maximize()
@@ -129,20 +118,22 @@ func main() {
 	orDie(err)
 	window.SetIcon([]image.Image{ico})
 	window.MakeContextCurrent()
-	window.SetKeyCallback(HandleKeys)
 	// OpenGL Initialization
 	// Check for the version
 	//version := gl.GoStr(gl.GetString(gl.VERSION))
 	//	fmt.Println("OpenGL Version", version)
-	// Read the vertex and fragment shader files
-	vertexShader, err := ioutil.ReadFile("vertex.vert")
-	orDie(err)
-	vertexShader = append(vertexShader, []byte("\x00")...)
-	fragmentShader, err := ioutil.ReadFile("frag.frag")
-	orDie(err)
-	fragmentShader = append(fragmentShader, []byte("\x00")...)
-
 	orDie(gl.Init())
+	// Glyphs are blended in with the coverage from their atlas
+	gl.Enable(gl.BLEND)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	// Anything still alive by now was leaked, report it in debug builds
+	// and free it before the context goes away
+	defer func() {
+		if debugBuild {
+			GLResources.ReportLeaks(os.Stderr)
+		}
+		GLResources.FreeAll()
+	}()
 
 	// Set the function for handling errors
 	gl.DebugMessageCallback(func(source, gltype, id, severity uint32, length int32, message string, userParam unsafe.Pointer) {
@@ -150,28 +141,74 @@ func main() {
 
 	}, nil)
 	// Create an OpenGL "Program" and link it for current drawing
-	prog, err := newProg(string(vertexShader), string(fragmentShader))
+	program, err := LoadProgram("vertex.vert", "frag.frag", PointLayout)
 	orDie(err)
+	defer program.Delete()
+	DefaultMaterial = NewMaterial(program)
+	DefaultFont = NewDefaultFont("", 0)
+	if path := os.Getenv("SNEK3D_FONT"); path != "" {
+		// Keep the built in font if the given one doesn't work out
+		if f, err := LoadFont(path, "", 0); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not load font %s: %v\n", path, err)
+		} else {
+			DefaultFont.Free()
+			DefaultFont = f
+		}
+	}
+	defer func() { DefaultFont.Free() }()
+	hud := NewHUD(DefaultFont)
+	defer hud.Free()
+	// Starts at the main menu, the handshake is done on connecting
+	client := NewClient(window, hud, DefaultFont)
+	defer client.Free()
+	window.SetKeyCallback(client.HandleKey)
+	// Recompile the shaders when they are edited, only in debug builds
+	var shaderWatcher *ShaderWatcher
+	if debugBuild {
+		shaderWatcher = NewShaderWatcher(program)
+	}
 	// Check for the version
 	// Main draw loop
 
-	// Set the refresh function for the window
-	// Use this program
-	gl.UseProgram(prog)
-	// Calculate the projection matrix
-	projMat = mgl32.Ident4()
-	// set the value of Projection matrix
-	UpdateUniformMat4fv("projection", program, &projMat[0])
-	// Set the value of view matrix
-	UpdateView(
-		mgl32.Vec3{0, 0, -1},
-		mgl32.Vec3{0, 0, 1},
-	)
-	program = prog
+	// The world is scaled down to fit in 0 to 1 on every axis
+	game := NewScene(NewIsoCamera(mgl32.Vec3{0.5, 0.5, 0.5}, 0.9))
+	Refresh(window, game.Camera)
+	hud.Scene.Camera.Resize(window.GetFramebufferSize())
+	client.Resize(window.GetFramebufferSize())
+	window.SetFramebufferSizeCallback(func(w *glfw.Window, width, height int) {
+		Refresh(w, game.Camera)
+		hud.Scene.Camera.Resize(width, height)
+		client.Resize(width, height)
+	})
+	// Clicking on a part of the snake or the food shows where it is in the title
+	window.SetMouseButtonCallback(func(w *glfw.Window, button glfw.MouseButton, action glfw.Action, mods glfw.ModifierKey) {
+		// Buttons on the screen get the click before the game
+		if ActiveUI != nil && ActiveUI.HandleMouseButton(w, button, action, mods) {
+			return
+		}
+		if button != glfw.MouseButtonLeft || action != glfw.Press {
+			return
+		}
+		x, y := w.GetCursorPos()
+		width, height := w.GetSize()
+		hit := game.Pick(x, y, width, height)
+		if hit == nil {
+			w.SetTitle(title)
+			return
+		}
+		// Undo the scaling done in NextFrame to get the cell sent by the server
+		pos := hit.Model.Col(3)
+		w.SetTitle(fmt.Sprintf("%s (%.0f, %.0f, %.0f)", title,
+			float64(pos.X())*maxWorldX, float64(pos.Y())*maxWorldY, float64(pos.Z())*maxWorldZ))
+	})
+	window.SetCursorPosCallback(func(w *glfw.Window, x, y float64) {
+		if ActiveUI != nil {
+			ActiveUI.HandleCursor(w, x, y)
+		}
+	})
 	// GLFW Initialization
 	CurrPoint = mgl32.Vec2{0, 0}
-	eyePos = mgl32.Vec3{0, 0, 1}
-	WhiteCube := NewShape(Ident, program, []*Point{
+	WhiteCube := NewShape(Ident, DefaultMaterial, []*Point{
 		PC(1, 1, 1, 1, 1, 1, 1),
 		PC(-1, 1, 1, 1, 1, 1, 1),
 		PC(-1, -1, 1, 1, 1, 1, 1),
@@ -181,7 +218,7 @@ func main() {
 		PC(1, -1, 1, 1, 1, 1, 1),
 		PC(-1, 1, -1, 1, 1, 1, 1),
 	}...)
-	RedCube := NewShape(Ident, program, []*Point{
+	RedCube := NewShape(Ident, DefaultMaterial, []*Point{
 		PC(1, 1, 1, 1, 0, 0, 1),
 		PC(-1, 1, 1, 1, 0, 0, 1),
 		PC(-1, -1, 1, 1, 0, 0, 1),
@@ -195,11 +232,60 @@ func main() {
 	RedCube.SetTypes(gl.LINE_LOOP)
 	WhiteCube.GenVao()
 	RedCube.GenVao()
+	defer WhiteCube.Free()
+	defer RedCube.Free()
+	snake := NewNode(Ident, nil)
+	food := NewNode(Ident, RedCube)
+	game.Root.Add(snake, food)
+	for !window.ShouldClose() && !Quitting() {
+		time.Sleep(fps)
+		if shaderWatcher != nil {
+			shaderWatcher.Poll()
+		}
+		// Clear everything that was drawn previously
+		gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+		// Actually draw something
+		//		b.Draw()
+		framesDrawn++
+		frame := client.Tick()
+		snake.Clear()
+		for _, v := range frame.Snake {
+			snake.Add(NewNode(mgl32.Translate3D(v.X(), v.Y(), v.Z()), WhiteCube))
+		}
+		food.Transform = mgl32.Translate3D(frame.Food.X(), frame.Food.Y(), frame.Food.Z())
+		game.Invalidate()
+		game.Draw()
+		hud.Draw(frame)
+		if ActiveUI != nil {
+			ActiveUI.Draw()
+		}
+		//		fnt.GlyphMap['e'].Draw()
+		// display everything that was drawn
+		window.SwapBuffers()
+		// check for any events
+		glfw.PollEvents()
+	}
+	// The window was closed, Quit was clicked or a signal came in,
+	// the deferred calls free everything else on the way out
+	if client.Connected {
+		Disconnect()
+	}
+}
+
+// Positions of everything in the game world, as sent by the server
+type Frame struct {
+	Snake []mgl32.Vec3
+	Food  mgl32.Vec3
+}
+
+// Reads the size of the coordinates and of the world from the server,
+// which it sends once before the first frame, and again after it restarts
+func Handshake() error {
 	lenBitsBytes := make([]byte, 1)
-	inputFile.Read(lenBitsBytes)
+	if _, err := io.ReadFull(inputFile, lenBitsBytes); err != nil {
+		return err
+	}
 	lenBits = lenBitsBytes[0]
-	coordBytes = make([]byte, lenBits>>3)
-	inputFile.Read(coordBytes)
 	switch lenBits {
 	case 8:
 		bytesToU64 = func(a []byte) uint64 { return uint64(a[0]) }
@@ -209,56 +295,60 @@ func main() {
 		bytesToU64 = func(a []byte) uint64 { return uint64(endianness.Uint32(a)) }
 	case 64:
 		bytesToU64 = endianness.Uint64
+	default:
+		return fmt.Errorf("the server uses %d bit coordinates, only 8, 16, 32 and 64 are supported", lenBits)
 	}
+	coordBytes = make([]byte, lenBits>>3)
+	var err error
+	for _, max := range []*float64{&maxWorldX, &maxWorldY, &maxWorldZ} {
+		if *max, err = readCoord(); err != nil {
+			return err
+		}
+		// Positions are divided by it
+		if *max == 0 {
+			return fmt.Errorf("the server sent an empty world")
+		}
+	}
+	return nil
+}
 
-	maxWorldX = float64(bytesToU64(coordBytes))
-	inputFile.Read(coordBytes)
-	maxWorldY = float64(bytesToU64(coordBytes))
-	inputFile.Read(coordBytes)
-	maxWorldZ = float64(bytesToU64(coordBytes))
-	for !window.ShouldClose() {
-		time.Sleep(fps)
-		// Clear everything that was drawn previously
-		gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
-		// Actually draw something
-		//		b.Draw()
-		framesDrawn++
-		fmt.Fprintf(os.Stderr, "Snake kitna lamba hai: %d", len(Snake))
-		for _, v := range Snake {
-			WhiteCube.ModelMat = mgl32.Translate3D(v.X(), v.Y(), v.Z())
-			WhiteCube.Draw()
-			os.Stderr.WriteString("Here?")
+// Reads the next coordinate sent by the server
+func readCoord() (float64, error) {
+	if _, err := io.ReadFull(inputFile, coordBytes); err != nil {
+		return 0, err
+	}
+	return float64(bytesToU64(coordBytes)), nil
+}
+
+// Reads a position, scaled down to fit in 0 to 1 by the size of the world
+func readPos() (p mgl32.Vec3, err error) {
+	for i, max := range [3]float64{maxWorldX, maxWorldY, maxWorldZ} {
+		c, err := readCoord()
+		if err != nil {
+			return p, err
 		}
-		RedCube.ModelMat = mgl32.Translate3D(Food.X(), Food.Y(), Food.Z())
-		RedCube.Draw()
-		//		fnt.GlyphMap['e'].Draw()
-		// display everything that was drawn
-		window.SwapBuffers()
-		// check for any events
-		glfw.PollEvents()
+		p[i] = float32(c / max)
 	}
+	return p, nil
 }
 
-func NextFrame() (SnekPos []mgl32.Vec3, foodPos mgl32.Vec3) {
+// Reads the next frame from the server, the error is io.EOF if the server went away
+func NextFrame() (f Frame, err error) {
 	lenPointsBytes := make([]byte, 2)
-	inputFile.Read(lenPointsBytes)
+	if _, err = io.ReadFull(inputFile, lenPointsBytes); err != nil {
+		return f, err
+	}
 	lenPoints = binary.BigEndian.Uint16(lenPointsBytes)
-	inputFile.Read(coordBytes)
-	foodX := float32(float64(bytesToU64(coordBytes)) / maxWorldX)
-	inputFile.Read(coordBytes)
-	foodY := float32(float64(bytesToU64(coordBytes)) / maxWorldY)
-	inputFile.Read(coordBytes)
-	foodZ := float32(float64(bytesToU64(coordBytes)) / maxWorldZ)
-	foodPos = mgl32.Vec3{foodX, foodY, foodZ}
+	if f.Food, err = readPos(); err != nil {
+		return f, err
+	}
 	for i := uint64(3 + uint64(lenBits>>3)*3); i < uint64(lenPoints*uint16(lenBits>>3)); i += uint64(lenBits>>3) * 3 {
-		inputFile.Read(coordBytes)
-		x := float32(float64(bytesToU64(coordBytes)) / maxWorldX)
-		inputFile.Read(coordBytes)
-		y := float32(float64(bytesToU64(coordBytes)) / maxWorldY)
-		inputFile.Read(coordBytes)
-		z := float32(float64(bytesToU64(coordBytes)) / maxWorldZ)
-		SnekPos = append(SnekPos, mgl32.Vec3{x, y, z})
+		pos, err := readPos()
+		if err != nil {
+			return f, err
+		}
+		f.Snake = append(f.Snake, pos)
 	}
-	fmt.Fprintf(os.Stderr, "SnekPos: %+v, FoodPos: %+v", SnekPos, foodPos)
-	return SnekPos, foodPos
+	fmt.Fprintf(os.Stderr, "SnekPos: %+v, FoodPos: %+v", f.Snake, f.Food)
+	return f, nil
 }
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Material is a program along with the uniform values used to draw with it
+// Shapes sharing a material are drawn together by the Renderer
+type Material struct {
+	Prog *Program
+	// Multiplied with the color of every vertex
+	Tint mgl32.Vec4
+	// Width of lines in pixels, clamped to what the driver supports
+	LineWidth float32
+	// Shade using the normals of the points, otherwise use the color as is
+	Lighting bool
+	// 2D texture to sample with the texture coords of the points, 0 for none
+	Texture uint32
+	// Order of creation, used to sort draws
+	id int
+}
+
+var (
+	// Used by shapes which are not given a material
+	DefaultMaterial *Material
+	materialCount   int
+	// What was used last, so that consecutive draws don't set it again
+	activeMaterial *Material
+	activeProgram  uint32
+	// Largest line width the context accepts, 0 until queried
+	maxLineWidth float32
+)
+
+func NewMaterial(prog *Program) *Material {
+	materialCount++
+	return &Material{
+		Prog:      prog,
+		Tint:      mgl32.Vec4{1, 1, 1, 1},
+		LineWidth: 1,
+		id:        materialCount,
+	}
+}
+
+// Makes the material current, switching programs only when needed
+func (m *Material) Use() {
+	if m == activeMaterial {
+		return
+	}
+	activeMaterial = m
+	if m.Prog.Id != activeProgram {
+		m.Prog.Use()
+		activeProgram = m.Prog.Id
+	}
+	m.Prog.Vec4("tint", m.Tint)
+	m.Prog.Int("lighting", boolToInt(m.Lighting))
+	m.Prog.Int("textured", boolToInt(m.Texture != 0))
+	if m.Texture != 0 {
+		gl.ActiveTexture(gl.TEXTURE0)
+		gl.BindTexture(gl.TEXTURE_2D, m.Texture)
+		m.Prog.Sampler("tex", 0)
+	}
+	gl.LineWidth(mgl32.Clamp(m.LineWidth, 1, lineWidthLimit()))
+}
+
+// Forgets what is current, the next Use sets everything again
+// Call this after using programs or changing materials behind their back
+func ResetMaterials() {
+	activeMaterial = nil
+	activeProgram = 0
+}
+
+func lineWidthLimit() float32 {
+	if maxLineWidth == 0 {
+		var flags int32
+		gl.GetIntegerv(gl.CONTEXT_FLAGS, &flags)
+		if flags&gl.CONTEXT_FLAG_FORWARD_COMPATIBLE_BIT != 0 {
+			// Wide lines are an error in forward compatible contexts
+			maxLineWidth = 1
+		} else {
+			var widths [2]float32
+			gl.GetFloatv(gl.ALIASED_LINE_WIDTH_RANGE, &widths[0])
+			maxLineWidth = widths[1]
+		}
+	}
+	return maxLineWidth
+}
+
+func boolToInt(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type draw struct {
+	Material *Material
+	D        Drawable
+	Model    mgl32.Mat4
+}
+
+// Renderer collects draws for a frame and issues them grouped by material
+type Renderer struct {
+	queue []draw
+}
+
+// Queues d to be drawn with its model matrix multiplied by parent on the next Flush
+func (r *Renderer) Submit(d Drawable, parent mgl32.Mat4) {
+	switch d := d.(type) {
+	case *Shape:
+		r.queue = append(r.queue, draw{d.material(), d, parent})
+	case *Circle:
+		r.queue = append(r.queue, draw{d.material(), d, parent})
+	case *Button:
+		// Its parts can have different materials
+		r.Submit(d.Geometry, parent)
+		r.Submit(d.TextShape, parent)
+	default:
+		r.queue = append(r.queue, draw{nil, d, parent})
+	}
+}
+
+// Draws everything submitted since the last Flush as seen from cam, grouped by
+// program and then by material, draws with the same material keep the order they were submitted in
+func (r *Renderer) Flush(cam *Camera) {
+	ResetMaterials()
+	applied := make(map[*Program]bool)
+	for _, d := range r.queue {
+		if d.Material != nil && !applied[d.Material.Prog] {
+			cam.Apply(d.Material.Prog)
+			applied[d.Material.Prog] = true
+		}
+	}
+	sort.SliceStable(r.queue, func(i, j int) bool {
+		pi, mi := materialKey(r.queue[i].Material)
+		pj, mj := materialKey(r.queue[j].Material)
+		if pi != pj {
+			return pi < pj
+		}
+		return mi < mj
+	})
+	for _, d := range r.queue {
+		d.D.DrawAt(d.Model)
+	}
+	r.queue = r.queue[:0]
+}
+
+func materialKey(m *Material) (uint32, int) {
+	if m == nil {
+		return 0, 0
+	}
+	return m.Prog.Id, m.id
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// What the client is doing, decides where keys go and what is drawn
+const (
+	STATE_MENU = iota
+	STATE_PLAYING
+	STATE_PAUSED
+	STATE_REPLAY
+	// Lost the server, waiting to connect again
+	STATE_DISCONNECTED
+)
+
+// Commands sent to the server besides the moves in HandleKeys
+const (
+	CMD_QUIT   = byte('E')
+	CMD_PAUSE  = byte('P')
+	CMD_RESUME = byte('p')
+)
+
+// Size of the buttons of the menus and the space between them, in screen space
+const (
+	menuButtonW   = 0.8
+	menuButtonH   = 0.15
+	menuButtonGap = 0.05
+)
+
+const (
+	// How long to wait before the first retry after losing the server, doubled
+	// after every failed one up to maxRetryDelay
+	minRetryDelay = time.Second
+	maxRetryDelay = 30 * time.Second
+	// How long a retry waits for the server to open the FIFOs
+	reconnectTimeout = 10 * time.Second
+)
+
+type MenuItem struct {
+	Text string
+	CB   Callback
+}
+
+// Returns a UI with a button for each item, stacked from the top in the middle of the screen
+func NewMenu(cam *Camera, w *glfw.Window, font *Font, items ...MenuItem) *UI {
+	u := NewUI(cam)
+	height := float32(len(items))*(menuButtonH+menuButtonGap) - menuButtonGap
+	y := height / 2
+	for _, it := range items {
+		u.Add(NewButton(-menuButtonW/2, y, menuButtonW/2, y-menuButtonH, w, it.Text, it.CB, font))
+		y -= menuButtonH + menuButtonGap
+	}
+	return u
+}
+
+// Client ties the game, the HUD and the menus together
+type Client struct {
+	Win   *glfw.Window
+	State int
+	// Whether the handshake with the server is done
+	Connected bool
+	// Latest frame from the server, the server sends one after every command
+	Frame Frame
+	// Every frame received so far, played back by Replay
+	Recorded []Frame
+	replayAt int
+	HUD      *HUD
+	// Shared by the menus
+	Overlay                             *Camera
+	Main, Pause, Settings, Disconnected *UI
+	replayBtn, hudBtn                   *Button
+	statusBtn, retryBtn                 *Button
+	// When to try connecting again, and how long to wait after that if it fails
+	retryAt    time.Time
+	retryDelay time.Duration
+	// Gets the FIFOs opened by the retry in progress, nil if there is none
+	retrying <-chan Reopened
+}
+
+func NewClient(w *glfw.Window, hud *HUD, font *Font) *Client {
+	c := &Client{Win: w, HUD: hud, Overlay: NewOverlayCamera()}
+	c.Main = NewMenu(c.Overlay, w, font,
+		MenuItem{"Connect", func(b *Button) { c.Play() }},
+		MenuItem{"Replay", func(b *Button) { c.Replay() }},
+		MenuItem{"Settings", func(b *Button) { c.Show(c.Settings) }},
+		MenuItem{"Quit", func(b *Button) { c.Quit() }},
+	)
+	c.replayBtn = c.Main.Buttons[1]
+	c.replayBtn.SetDisabled(true)
+	c.Pause = NewMenu(c.Overlay, w, font,
+		MenuItem{"Resume", func(b *Button) { c.Play() }},
+		MenuItem{"Main menu", func(b *Button) { c.Menu() }},
+		MenuItem{"Quit", func(b *Button) { c.Quit() }},
+	)
+	c.Settings = NewMenu(c.Overlay, w, font,
+		MenuItem{c.hudLabel(), func(b *Button) { c.ToggleHUD() }},
+		MenuItem{"Back", func(b *Button) { c.Show(c.Main) }},
+	)
+	c.hudBtn = c.Settings.Buttons[0]
+	c.Disconnected = NewMenu(c.Overlay, w, font,
+		MenuItem{"Disconnected", nil},
+		MenuItem{"Retry now", func(b *Button) { c.retryAt = time.Now() }},
+		MenuItem{"Quit", func(b *Button) { c.Quit() }},
+	)
+	c.statusBtn, c.retryBtn = c.Disconnected.Buttons[0], c.Disconnected.Buttons[1]
+	// Only there to show the status
+	c.statusBtn.SetDisabled(true)
+	c.Menu()
+	return c
+}
+
+func (c *Client) ToggleHUD() {
+	c.HUD.Toggle()
+	c.hudBtn.SetText(c.hudLabel())
+}
+
+func (c *Client) hudLabel() string {
+	if c.HUD.Visible {
+		return "HUD: On"
+	}
+	return "HUD: Off"
+}
+
+// Makes u take the mouse and be drawn, nil for none
+func (c *Client) Show(u *UI) {
+	ActiveUI = u
+	if u != nil {
+		// Hover states are stale, the cursor moved while it was hidden
+		x, y := c.Win.GetCursorPos()
+		u.HandleCursor(c.Win, x, y)
+	}
+}
+
+// Sends cmd to the server and waits for the frame it answers with,
+// returns an error if the server is gone, the client is disconnected then
+func (c *Client) Send(cmd byte) error {
+	if _, err := outputFile.Write([]byte{cmd}); err != nil {
+		c.lost(err)
+		return err
+	}
+	return c.await()
+}
+
+// Waits for the next frame from the server, see Send
+func (c *Client) await() error {
+	f, err := NextFrame()
+	if err != nil {
+		c.lost(err)
+		return err
+	}
+	c.receive(f)
+	return nil
+}
+
+func (c *Client) receive(f Frame) {
+	c.Frame = f
+	c.Recorded = append(c.Recorded, f)
+	c.HUD.Tick(f)
+}
+
+// Goes to the main menu, pausing the game if it is being played
+func (c *Client) Menu() {
+	if c.State == STATE_PLAYING && c.Send(CMD_PAUSE) != nil {
+		return
+	}
+	c.State = STATE_MENU
+	c.replayBtn.SetDisabled(len(c.Recorded) == 0)
+	c.Show(c.Main)
+}
+
+// Starts the game, connecting to the server the first time and resuming it after that
+func (c *Client) Play() {
+	if !c.Connected {
+		if err := Handshake(); err != nil {
+			c.lost(err)
+			return
+		}
+		c.connected()
+		return
+	}
+	if c.State != STATE_PLAYING && c.Send(CMD_RESUME) != nil {
+		return
+	}
+	c.State = STATE_PLAYING
+	c.Show(nil)
+}
+
+// Starts a new game after the handshake, the world can be different from the last one
+func (c *Client) connected() {
+	c.Connected = true
+	c.Frame = Frame{}
+	c.Recorded = nil
+	c.HUD.Reset()
+	c.State = STATE_PLAYING
+	c.Show(nil)
+}
+
+// Drops the connection after err and shows the disconnected screen, from
+// which the client keeps trying to connect again
+func (c *Client) lost(err error) {
+	if Quitting() {
+		// The read was cut short on purpose
+		return
+	}
+	if err == io.EOF {
+		fmt.Fprintln(os.Stderr, "The server went away")
+	} else {
+		fmt.Fprintf(os.Stderr, "Lost the server: %v\n", err)
+	}
+	c.Connected = false
+	c.State = STATE_DISCONNECTED
+	// Nothing of the old game is shown anymore
+	c.Frame = Frame{}
+	c.retryDelay = minRetryDelay
+	c.retryAt = time.Now().Add(c.retryDelay)
+	c.retryBtn.SetDisabled(!CanReconnect())
+	c.updateStatus()
+	c.Show(c.Disconnected)
+}
+
+// Starts a retry once it is time for one, and takes the result of the one in progress
+func (c *Client) pollReconnect() {
+	if c.retrying != nil {
+		select {
+		case r := <-c.retrying:
+			c.retrying = nil
+			err := r.Use()
+			if err == nil {
+				// The server sends the sizes as soon as it has opened its ends,
+				// one which never does must not hang the window
+				err = inputFile.SetReadDeadline(time.Now().Add(reconnectTimeout))
+			}
+			if err == nil {
+				err = Handshake()
+				if clearErr := inputFile.SetReadDeadline(time.Time{}); err == nil {
+					err = clearErr
+				}
+			}
+			if err == nil {
+				c.connected()
+				return
+			}
+			fmt.Fprintf(os.Stderr, "Couldn't connect again: %v\n", err)
+			c.retryAt = time.Now().Add(c.retryDelay)
+			if c.retryDelay *= 2; c.retryDelay > maxRetryDelay {
+				c.retryDelay = maxRetryDelay
+			}
+		default:
+		}
+	} else if CanReconnect() && !time.Now().Before(c.retryAt) {
+		// Opening the FIFOs blocks until the server is back, so it is done in the
+		// background, everything they are used for stays on this thread
+		c.retrying = Reconnect(reconnectTimeout)
+	}
+	c.updateStatus()
+}
+
+// Shows what the disconnected screen is waiting for, the text is only changed when it differs
+func (c *Client) updateStatus() {
+	status := "Disconnected"
+	switch {
+	case c.retrying != nil:
+		status = "Reconnecting..."
+	case CanReconnect():
+		status = fmt.Sprintf("Retrying in %ds", int(time.Until(c.retryAt).Seconds()+1))
+	}
+	if status != c.statusBtn.Text {
+		c.statusBtn.SetText(status)
+	}
+}
+
+func (c *Client) PauseGame() {
+	if c.Send(CMD_PAUSE) != nil {
+		return
+	}
+	c.State = STATE_PAUSED
+	c.Show(c.Pause)
+}
+
+// Plays back the frames received so far, one every time Tick is called
+func (c *Client) Replay() {
+	if len(c.Recorded) == 0 {
+		return
+	}
+	c.State = STATE_REPLAY
+	c.replayAt = 0
+	c.Show(nil)
+}
+
+// Closes the window, main takes care of leaving the server
+func (c *Client) Quit() {
+	c.Win.SetShouldClose(true)
+}
+
+// Returns the frame to draw, advancing the replay if there is one and
+// trying to connect again if the server is gone
+func (c *Client) Tick() Frame {
+	if c.State == STATE_DISCONNECTED {
+		c.pollReconnect()
+	}
+	if c.State != STATE_REPLAY {
+		return c.Frame
+	}
+	f := c.Recorded[c.replayAt]
+	c.replayAt++
+	if c.replayAt == len(c.Recorded) {
+		c.Menu()
+	}
+	return f
+}
+
+// Escape pauses the game or goes back a screen, H toggles the HUD and
+// every other key is sent to the server while playing, use it as the KeyCallback
+func (c *Client) HandleKey(w *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+	if key == glfw.KeyH {
+		// The server never hears of it
+		if action == glfw.Press {
+			c.ToggleHUD()
+		}
+		return
+	}
+	if c.State == STATE_PLAYING && key != glfw.KeyEscape {
+		if err := HandleKeys(w, key, scancode, action, mods); err != nil {
+			c.lost(err)
+			return
+		}
+		c.await()
+		return
+	}
+	// The disconnected screen is left by connecting again or with its buttons
+	if key != glfw.KeyEscape || action != glfw.Press || c.State == STATE_DISCONNECTED {
+		return
+	}
+	switch {
+	case c.State == STATE_PLAYING:
+		c.PauseGame()
+	case c.State == STATE_PAUSED:
+		c.Play()
+	case c.State == STATE_REPLAY:
+		c.Menu()
+	case ActiveUI == c.Settings:
+		c.Show(c.Main)
+	default:
+		c.Quit()
+	}
+}
+
+// Keeps the menus in sync with the framebuffer, use it in the FramebufferSizeCallback
+func (c *Client) Resize(width, height int) {
+	c.Overlay.Resize(width, height)
+}
+
+func (c *Client) Free() {
+	c.Main.Free()
+	c.Pause.Free()
+	c.Settings.Free()
+	c.Disconnected.Free()
+}
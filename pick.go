@@ -0,0 +1,76 @@
+package main
+
+import (
+	"math"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// What a ray from the cursor hit
+type Hit struct {
+	Node  *Node
+	Shape *Shape
+	// World space point of the hit and its distance from the eye
+	At   mgl32.Vec3
+	Dist float32
+	// Model matrix the shape was drawn with
+	Model mgl32.Mat4
+}
+
+// Returns the origin and direction of the ray going through the point
+// x, y of a width by height window, as given by the cursor callbacks
+func (c *Camera) Ray(x, y float64, width, height int) (origin, dir mgl32.Vec3) {
+	// Window coords have y going down, normalized device coords have it going up
+	nx := float32(2*x/float64(width) - 1)
+	ny := float32(1 - 2*y/float64(height))
+	inv := UnProject(c.View(), c.Proj())
+	near := mgl32.TransformCoordinate(mgl32.Vec3{nx, ny, -1}, inv)
+	far := mgl32.TransformCoordinate(mgl32.Vec3{nx, ny, 1}, inv)
+	return near, far.Sub(near).Normalize()
+}
+
+// Returns the nearest Shape under the point x, y of a width by height window,
+// nil if there is nothing there
+// Shapes made of triangles are hit on their triangles, others on their bounding box
+// Shapes are looked up in the BVH of the scene, see Invalidate
+func (s *Scene) Pick(x, y float64, width, height int) *Hit {
+	origin, dir := s.Camera.Ray(x, y, width, height)
+	var nearest *Hit
+	s.BVH().Ray(origin, dir, func(it *BVHItem, t float32) float32 {
+		at, ok := rayShapeCollision(origin, dir, it.Shape, it.Parent)
+		if !ok {
+			return float32(math.Inf(1))
+		}
+		dist := at.Sub(origin).Len()
+		if nearest == nil || dist < nearest.Dist {
+			nearest = &Hit{it.Node, it.Shape, at, dist, it.Parent.Mul4(it.Shape.ModelMat)}
+		}
+		return nearest.Dist
+	})
+	return nearest
+}
+
+// Returns where the ray hits s drawn at parent
+func rayShapeCollision(origin, dir mgl32.Vec3, s *Shape, parent mgl32.Mat4) (mgl32.Vec3, bool) {
+	switch s.Type {
+	case gl.TRIANGLES, gl.TRIANGLE_FAN, gl.TRIANGLE_STRIP:
+		hits := NewRay(RAY_TYPE_CENTERED, mgl32.Ident4(), origin, origin.Add(dir)).PolyCollideAt(s, parent)
+		if len(hits) == 0 {
+			return mgl32.Vec3{}, false
+		}
+		return hits[0].At, true
+	default:
+		// Lines and points are too thin to click, use the box around them
+		// Test in model space, so that the box needn't be transformed
+		model := parent.Mul4(s.ModelMat)
+		inv := model.Inv()
+		localOrigin := mgl32.TransformCoordinate(origin, inv)
+		localDir := mgl32.TransformNormal(dir, inv)
+		t, ok := s.Bounds().Ray(localOrigin, localDir)
+		if !ok {
+			return mgl32.Vec3{}, false
+		}
+		return mgl32.TransformCoordinate(localOrigin.Add(localDir.Mul(t)), model), true
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	pickGrid   = 20
+	pickWidth  = 800
+	pickHeight = 800
+)
+
+// A square of two triangles around the origin, 2*half wide
+func testSquare(half float32) *Shape {
+	s := NewShape(mgl32.Ident4(), nil,
+		P(-half, -half, 0), P(half, -half, 0), P(half, half, 0),
+		P(-half, -half, 0), P(half, half, 0), P(-half, half, 0),
+	)
+	s.SetTypes(gl.TRIANGLES)
+	return s
+}
+
+// A grid of pickGrid*pickGrid squares seen from above, all sharing one Shape
+// like the segments of the snake, every row is a node of its own, and the
+// squares are at different heights so that they overlap in some places
+func testPickScene() *Scene {
+	s := NewScene(NewOverlayCamera())
+	square := testSquare(1.2 / pickGrid)
+	step := float32(2) / pickGrid
+	for y := 0; y < pickGrid; y++ {
+		row := NewNode(mgl32.Translate3D(0, -1+step*(float32(y)+0.5), 0), nil)
+		for x := 0; x < pickGrid; x++ {
+			z := float32((x*7+y*3)%5) / 10
+			row.Add(NewNode(mgl32.Translate3D(-1+step*(float32(x)+0.5), 0, z), square))
+		}
+		s.Root.Add(row)
+	}
+	// Hidden nodes can't be picked
+	hidden := NewNode(mgl32.Translate3D(0, 0, 1), testSquare(2))
+	hidden.Hidden = true
+	s.Root.Add(hidden)
+	return s
+}
+
+// Tests every shape of the scene, as Pick did before there was a BVH
+func pickBruteForce(s *Scene, x, y float64, width, height int) *Hit {
+	origin, dir := s.Camera.Ray(x, y, width, height)
+	var nearest *Hit
+	var visit func(n *Node, parent mgl32.Mat4)
+	visit = func(n *Node, parent mgl32.Mat4) {
+		if n.Hidden {
+			return
+		}
+		model := parent.Mul4(n.Transform)
+		if shape, ok := n.D.(*Shape); ok {
+			if at, ok := rayShapeCollision(origin, dir, shape, model); ok {
+				dist := at.Sub(origin).Len()
+				if nearest == nil || dist < nearest.Dist {
+					nearest = &Hit{n, shape, at, dist, model.Mul4(shape.ModelMat)}
+				}
+			}
+		}
+		for _, c := range n.Children {
+			visit(c, model)
+		}
+	}
+	visit(s.Root, mgl32.Ident4())
+	return nearest
+}
+
+// Cursor positions spread over the window, some between squares
+func pickCursors() [][2]float64 {
+	var cursors [][2]float64
+	for i := 0; i < 37; i++ {
+		for j := 0; j < 37; j++ {
+			cursors = append(cursors, [2]float64{float64(i) * pickWidth / 36, float64(j) * pickHeight / 36})
+		}
+	}
+	return cursors
+}
+
+func TestPickMatchesBruteForce(t *testing.T) {
+	s := testPickScene()
+	hits := 0
+	for _, c := range pickCursors() {
+		got := s.Pick(c[0], c[1], pickWidth, pickHeight)
+		want := pickBruteForce(s, c[0], c[1], pickWidth, pickHeight)
+		if (got == nil) != (want == nil) {
+			t.Errorf("cursor %v: Pick = %v, brute force = %v", c, got, want)
+			continue
+		}
+		if got == nil {
+			continue
+		}
+		hits++
+		if math.Abs(float64(got.Dist-want.Dist)) > 1e-5 {
+			t.Errorf("cursor %v: Pick hit at %v, brute force at %v", c, got.Dist, want.Dist)
+		}
+	}
+	if hits == 0 {
+		t.Error("nothing was hit, the scene is not in view")
+	}
+}
+
+func TestPickInvalidate(t *testing.T) {
+	s := NewScene(NewOverlayCamera())
+	n := NewNode(mgl32.Ident4(), testSquare(0.1))
+	s.Root.Add(n)
+	if s.Pick(pickWidth/2, pickHeight/2, pickWidth, pickHeight) == nil {
+		t.Fatal("missed the square in the middle of the screen")
+	}
+	n.Transform = mgl32.Translate3D(0.5, 0, 0)
+	if s.Pick(pickWidth/2, pickHeight/2, pickWidth, pickHeight) == nil {
+		t.Error("the BVH was rebuilt without Invalidate")
+	}
+	s.Invalidate()
+	if hit := s.Pick(pickWidth/2, pickHeight/2, pickWidth, pickHeight); hit != nil {
+		t.Errorf("hit the moved square at %v", hit.At)
+	}
+	if s.Pick(pickWidth*3/4, pickHeight/2, pickWidth, pickHeight) == nil {
+		t.Error("missed the square where it was moved to")
+	}
+}
+
+func BenchmarkPickBVH(b *testing.B) {
+	s := testPickScene()
+	cursors := pickCursors()
+	// Build it outside of the timer, it is reused until the scene changes
+	s.BVH()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c := cursors[i%len(cursors)]
+		s.Pick(c[0], c[1], pickWidth, pickHeight)
+	}
+}
+
+func BenchmarkPickBruteForce(b *testing.B) {
+	s := testPickScene()
+	cursors := pickCursors()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c := cursors[i%len(cursors)]
+		pickBruteForce(s, c[0], c[1], pickWidth, pickHeight)
+	}
+}
+
+// What a pick costs right after the scene changed, as it does every frame in the game
+func BenchmarkPickBVHRebuild(b *testing.B) {
+	s := testPickScene()
+	cursors := pickCursors()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c := cursors[i%len(cursors)]
+		s.Invalidate()
+		s.Pick(c[0], c[1], pickWidth, pickHeight)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// An active uniform of a linked program
+type Uniform struct {
+	Location int32
+	// GLSL type as reported by the driver, eg. gl.FLOAT_MAT4
+	Type uint32
+	// Number of elements, more than 1 for arrays
+	Size int32
+}
+
+// Program is a linked shader program along with the locations of all of its
+// uniforms, looked up once after linking instead of on every draw
+type Program struct {
+	Id       uint32
+	Uniforms map[string]Uniform
+	// Where the shaders were loaded from, empty if they weren't read from files
+	VertPath, FragPath string
+	Layout             VertexLayout
+}
+
+func NewProgram(vertShad, fragShad string, layout VertexLayout) (*Program, error) {
+	id, err := newProg(vertShad, fragShad, layout)
+	if err != nil {
+		return nil, err
+	}
+	p := &Program{Id: id, Layout: layout}
+	p.loadUniforms()
+	return p, nil
+}
+
+// Reads the shaders from the given files and links them into a program
+func LoadProgram(vertPath, fragPath string, layout VertexLayout) (*Program, error) {
+	vertShad, err := ioutil.ReadFile(vertPath)
+	if err != nil {
+		return nil, err
+	}
+	fragShad, err := ioutil.ReadFile(fragPath)
+	if err != nil {
+		return nil, err
+	}
+	p, err := NewProgram(string(vertShad)+"\x00", string(fragShad)+"\x00", layout)
+	if err != nil {
+		return nil, fmt.Errorf("%s, %s: %v", vertPath, fragPath, err)
+	}
+	p.VertPath, p.FragPath = vertPath, fragPath
+	return p, nil
+}
+
+// Loads the shader files again and swaps them in if they link, on error
+// the old program is kept as is
+// Uniforms start out zeroed in the new program, they have to be set again
+// The setters are typed by the Go code, so a program whose uniforms changed type
+// is rejected rather than making the next set panic
+func (p *Program) Reload() error {
+	newP, err := LoadProgram(p.VertPath, p.FragPath, p.Layout)
+	if err != nil {
+		return err
+	}
+	if err := checkUniformTypes(p.Uniforms, newP.Uniforms); err != nil {
+		newP.Delete()
+		return fmt.Errorf("%s, %s: %v", p.VertPath, p.FragPath, err)
+	}
+	GLResources.DeleteProgram(&p.Id)
+	p.Id, p.Uniforms = newP.Id, newP.Uniforms
+	return nil
+}
+
+// Returns an error naming the first uniform present in both with a different type
+// Added and removed uniforms are fine, missing ones are ignored by the setters
+func checkUniformTypes(old, reloaded map[string]Uniform) error {
+	names := make([]string, 0, len(reloaded))
+	for name := range reloaded {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if u, ok := old[name]; ok && u.Type != reloaded[name].Type {
+			return fmt.Errorf("uniform %s changed type from 0x%X to 0x%X, restart to use it", name, u.Type, reloaded[name].Type)
+		}
+	}
+	return nil
+}
+
+func (p *Program) loadUniforms() {
+	p.Uniforms = make(map[string]Uniform)
+	var count, maxLen int32
+	gl.GetProgramiv(p.Id, gl.ACTIVE_UNIFORMS, &count)
+	gl.GetProgramiv(p.Id, gl.ACTIVE_UNIFORM_MAX_LENGTH, &maxLen)
+	for i := int32(0); i < count; i++ {
+		var length, size int32
+		var glType uint32
+		nameBuf := make([]byte, maxLen+1)
+		gl.GetActiveUniform(p.Id, uint32(i), maxLen+1, &length, &size, &glType, &nameBuf[0])
+		name := string(nameBuf[:length])
+		p.Uniforms[name] = Uniform{
+			Location: gl.GetUniformLocation(p.Id, gl.Str(name+"\x00")),
+			Type:     glType,
+			Size:     size,
+		}
+	}
+}
+
+func (p *Program) Use() {
+	gl.UseProgram(p.Id)
+}
+
+func (p *Program) Delete() {
+	GLResources.DeleteProgram(&p.Id)
+}
+
+// Returns the location of the uniform name, or -1 if the program doesn't have it
+// Uniforms which are declared but unused are dropped by the linker, so missing
+// ones are ignored, but setting one with a different type is a bug
+func (p *Program) location(name string, glTypes ...uint32) int32 {
+	u, ok := p.Uniforms[name]
+	if !ok {
+		return -1
+	}
+	for _, t := range glTypes {
+		if u.Type == t {
+			return u.Location
+		}
+	}
+	panic(fmt.Sprintf("uniform %s has type 0x%X, not 0x%X", name, u.Type, glTypes[0]))
+}
+
+// The setters use ProgramUniform, so the program need not be in use
+
+func (p *Program) Mat4(name string, m mgl32.Mat4) {
+	gl.ProgramUniformMatrix4fv(p.Id, p.location(name, gl.FLOAT_MAT4), 1, false, &m[0])
+}
+
+func (p *Program) Vec2(name string, v mgl32.Vec2) {
+	gl.ProgramUniform2f(p.Id, p.location(name, gl.FLOAT_VEC2), v[0], v[1])
+}
+
+func (p *Program) Vec3(name string, v mgl32.Vec3) {
+	gl.ProgramUniform3f(p.Id, p.location(name, gl.FLOAT_VEC3), v[0], v[1], v[2])
+}
+
+func (p *Program) Vec4(name string, v mgl32.Vec4) {
+	gl.ProgramUniform4f(p.Id, p.location(name, gl.FLOAT_VEC4), v[0], v[1], v[2], v[3])
+}
+
+func (p *Program) Float(name string, f float32) {
+	gl.ProgramUniform1f(p.Id, p.location(name, gl.FLOAT), f)
+}
+
+// Booleans are set through Int as well
+func (p *Program) Int(name string, i int32) {
+	gl.ProgramUniform1i(p.Id, p.location(name, gl.INT, gl.BOOL), i)
+}
+
+// Sets the texture unit a sampler reads from
+func (p *Program) Sampler(name string, unit int32) {
+	gl.ProgramUniform1i(p.Id, p.location(name, gl.SAMPLER_2D, gl.SAMPLER_CUBE, gl.SAMPLER_3D), unit)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+func TestCheckUniformTypes(t *testing.T) {
+	old := map[string]Uniform{
+		"model": {Location: 0, Type: gl.FLOAT_MAT4},
+		"tint":  {Location: 1, Type: gl.FLOAT_VEC4},
+		"lit":   {Location: 2, Type: gl.BOOL},
+	}
+	cases := []struct {
+		name    string
+		new     map[string]Uniform
+		changed string
+	}{
+		{"same", old, ""},
+		{"moved", map[string]Uniform{"model": {Location: 3, Type: gl.FLOAT_MAT4}}, ""},
+		{"added", map[string]Uniform{"tex": {Type: gl.SAMPLER_2D}, "tint": {Type: gl.FLOAT_VEC4}}, ""},
+		{"retyped", map[string]Uniform{"model": {Type: gl.FLOAT_MAT4}, "tint": {Type: gl.FLOAT_VEC3}}, "tint"},
+	}
+	for _, c := range cases {
+		err := checkUniformTypes(old, c.new)
+		switch {
+		case c.changed == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		case c.changed != "" && (err == nil || !strings.Contains(err.Error(), c.changed)):
+			t.Errorf("%s: error %v does not name %s", c.name, err, c.changed)
+		}
+	}
+}
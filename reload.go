@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// ShaderWatcher reloads programs whose shader files have changed on disk,
+// it is only used in debug builds so that shaders can be edited while the game runs
+type ShaderWatcher struct {
+	Progs    []*Program
+	modTimes map[string]time.Time
+}
+
+func NewShaderWatcher(progs ...*Program) *ShaderWatcher {
+	w := &ShaderWatcher{
+		Progs:    progs,
+		modTimes: make(map[string]time.Time),
+	}
+	// Record the current times so that the first Poll doesn't reload everything
+	for _, p := range progs {
+		w.changed(p.VertPath)
+		w.changed(p.FragPath)
+	}
+	return w
+}
+
+// Reports whether the file was modified since the last call
+func (w *ShaderWatcher) changed(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		// Editors often delete and recreate the file on save, wait for it to come back
+		return false
+	}
+	prev, ok := w.modTimes[path]
+	w.modTimes[path] = info.ModTime()
+	return ok && !info.ModTime().Equal(prev)
+}
+
+// Checks the shader files of every program and reloads the changed ones,
+// errors are written to stderr and the old program is kept
+// Returns the programs which were swapped, their uniforms need to be set again
+func (w *ShaderWatcher) Poll() (reloaded []*Program) {
+	for _, p := range w.Progs {
+		// Both have to be checked, so that both times are updated
+		vertChanged := w.changed(p.VertPath)
+		fragChanged := w.changed(p.FragPath)
+		if !vertChanged && !fragChanged {
+			continue
+		}
+		if err := p.Reload(); err != nil {
+			fmt.Fprintf(os.Stderr, "keeping the old shaders: %v\n", err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "reloaded %s, %s\n", p.VertPath, p.FragPath)
+		reloaded = append(reloaded, p)
+	}
+	return reloaded
+}
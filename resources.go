@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// Kinds of OpenGL objects tracked by Resources
+const (
+	RES_VAO = iota
+	RES_VBO
+	RES_PROGRAM
+	RES_TEXTURE
+)
+
+// GLBackend is the subset of OpenGL used to create and delete objects,
+// the default one calls straight into gl, swap it out to run without a context
+type GLBackend interface {
+	GenVertexArray() uint32
+	GenBuffer() uint32
+	GenTexture() uint32
+	DeleteVertexArray(id uint32)
+	DeleteBuffer(id uint32)
+	DeleteProgram(id uint32)
+	DeleteTexture(id uint32)
+}
+
+type glBackend struct{}
+
+func (glBackend) GenVertexArray() uint32 {
+	var id uint32
+	gl.GenVertexArrays(1, &id)
+	return id
+}
+
+func (glBackend) GenBuffer() uint32 {
+	var id uint32
+	gl.GenBuffers(1, &id)
+	return id
+}
+
+func (glBackend) GenTexture() uint32 {
+	var id uint32
+	gl.GenTextures(1, &id)
+	return id
+}
+
+func (glBackend) DeleteVertexArray(id uint32) { gl.DeleteVertexArrays(1, &id) }
+func (glBackend) DeleteBuffer(id uint32)      { gl.DeleteBuffers(1, &id) }
+func (glBackend) DeleteProgram(id uint32)     { gl.DeleteProgram(id) }
+func (glBackend) DeleteTexture(id uint32)     { gl.DeleteTextures(1, &id) }
+
+type resource struct {
+	Kind int
+	Id   uint32
+}
+
+// Resources keeps track of every VAO, VBO, texture and program created through it
+// so that they can be freed deterministically and leaks can be reported
+type Resources struct {
+	Backend GLBackend
+	// Where each live object was created, only filled in debug builds
+	live map[resource]string
+	// Order of creation, used to free objects in reverse
+	order []resource
+}
+
+// All GL objects of the client are created through this
+var GLResources = NewResources(glBackend{})
+
+func NewResources(backend GLBackend) *Resources {
+	return &Resources{
+		Backend: backend,
+		live:    make(map[resource]string),
+	}
+}
+
+// Number of frames kept in the creation site of a leaked object
+const leakSiteDepth = 3
+
+// Describes where an object is being created, skipping the frames inside the
+// resource manager and the vertex layout since every Vao and Vbo goes through them
+func creationSite() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	sites := make([]string, 0, leakSiteDepth)
+	for len(sites) < leakSiteDepth {
+		frame, more := frames.Next()
+		switch filepath.Base(frame.File) {
+		case "resources.go", "layout.go":
+		default:
+			if frame.File != "" {
+				sites = append(sites, fmt.Sprintf("%s:%d", frame.File, frame.Line))
+			}
+		}
+		if !more {
+			break
+		}
+	}
+	return strings.Join(sites, " <- ")
+}
+
+func (r *Resources) track(kind int, id uint32) {
+	site := ""
+	if debugBuild {
+		site = creationSite()
+	}
+	res := resource{kind, id}
+	r.live[res] = site
+	r.order = append(r.order, res)
+}
+
+func (r *Resources) untrack(kind int, id uint32) bool {
+	res := resource{kind, id}
+	if _, ok := r.live[res]; !ok {
+		return false
+	}
+	delete(r.live, res)
+	for i := len(r.order) - 1; i >= 0; i-- {
+		if r.order[i] == res {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+func (r *Resources) GenVertexArray() uint32 {
+	id := r.Backend.GenVertexArray()
+	r.track(RES_VAO, id)
+	return id
+}
+
+func (r *Resources) GenBuffer() uint32 {
+	id := r.Backend.GenBuffer()
+	r.track(RES_VBO, id)
+	return id
+}
+
+func (r *Resources) GenTexture() uint32 {
+	id := r.Backend.GenTexture()
+	r.track(RES_TEXTURE, id)
+	return id
+}
+
+// Programs are created by newProg, this just starts tracking one
+func (r *Resources) TrackProgram(id uint32) {
+	r.track(RES_PROGRAM, id)
+}
+
+// Deletes the VAO pointed to by id and sets it to 0,
+// does nothing if it isn't tracked (already freed or never created)
+func (r *Resources) DeleteVertexArray(id *uint32) {
+	if r.untrack(RES_VAO, *id) {
+		r.Backend.DeleteVertexArray(*id)
+	}
+	*id = 0
+}
+
+// Same as DeleteVertexArray, but for buffers
+func (r *Resources) DeleteBuffer(id *uint32) {
+	if r.untrack(RES_VBO, *id) {
+		r.Backend.DeleteBuffer(*id)
+	}
+	*id = 0
+}
+
+// Same as DeleteVertexArray, but for programs
+func (r *Resources) DeleteProgram(id *uint32) {
+	if r.untrack(RES_PROGRAM, *id) {
+		r.Backend.DeleteProgram(*id)
+	}
+	*id = 0
+}
+
+// Same as DeleteVertexArray, but for textures
+func (r *Resources) DeleteTexture(id *uint32) {
+	if r.untrack(RES_TEXTURE, *id) {
+		r.Backend.DeleteTexture(*id)
+	}
+	*id = 0
+}
+
+// Number of objects created and not yet deleted
+func (r *Resources) Live() int {
+	return len(r.live)
+}
+
+// Writes every object still alive to w, returns the number of them
+func (r *Resources) ReportLeaks(w io.Writer) int {
+	names := [...]string{RES_VAO: "VAO", RES_VBO: "VBO", RES_PROGRAM: "program", RES_TEXTURE: "texture"}
+	leaks := make([]string, 0, len(r.live))
+	for res, site := range r.live {
+		leak := fmt.Sprintf("leaked %s %d", names[res.Kind], res.Id)
+		if site != "" {
+			leak += " created at " + site
+		}
+		leaks = append(leaks, leak)
+	}
+	sort.Strings(leaks)
+	for _, leak := range leaks {
+		fmt.Fprintln(w, leak)
+	}
+	return len(leaks)
+}
+
+// Deletes every object still alive, newest first
+func (r *Resources) FreeAll() {
+	for i := len(r.order) - 1; i >= 0; i-- {
+		res := r.order[i]
+		switch res.Kind {
+		case RES_VAO:
+			r.Backend.DeleteVertexArray(res.Id)
+		case RES_VBO:
+			r.Backend.DeleteBuffer(res.Id)
+		case RES_PROGRAM:
+			r.Backend.DeleteProgram(res.Id)
+		case RES_TEXTURE:
+			r.Backend.DeleteTexture(res.Id)
+		}
+	}
+	r.live = make(map[resource]string)
+	r.order = nil
+}
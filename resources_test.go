@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Hands out increasing ids and records every delete in order
+type fakeBackend struct {
+	next    uint32
+	deleted []resource
+}
+
+func (f *fakeBackend) gen() uint32 {
+	f.next++
+	return f.next
+}
+
+func (f *fakeBackend) GenVertexArray() uint32 { return f.gen() }
+func (f *fakeBackend) GenBuffer() uint32      { return f.gen() }
+func (f *fakeBackend) GenTexture() uint32     { return f.gen() }
+
+func (f *fakeBackend) DeleteVertexArray(id uint32) {
+	f.deleted = append(f.deleted, resource{RES_VAO, id})
+}
+
+func (f *fakeBackend) DeleteBuffer(id uint32) {
+	f.deleted = append(f.deleted, resource{RES_VBO, id})
+}
+
+func (f *fakeBackend) DeleteProgram(id uint32) {
+	f.deleted = append(f.deleted, resource{RES_PROGRAM, id})
+}
+
+func (f *fakeBackend) DeleteTexture(id uint32) {
+	f.deleted = append(f.deleted, resource{RES_TEXTURE, id})
+}
+
+func TestResourcesTrack(t *testing.T) {
+	fake := &fakeBackend{}
+	r := NewResources(fake)
+	vao := r.GenVertexArray()
+	vbo := r.GenBuffer()
+	tex := r.GenTexture()
+	r.TrackProgram(100)
+	if r.Live() != 4 {
+		t.Fatalf("Live() = %d after creating 4 objects", r.Live())
+	}
+
+	r.DeleteBuffer(&vbo)
+	if vbo != 0 {
+		t.Errorf("DeleteBuffer left the id at %d, want 0", vbo)
+	}
+	if r.Live() != 3 {
+		t.Errorf("Live() = %d after deleting 1 of 4", r.Live())
+	}
+	want := []resource{{RES_VBO, 2}}
+	if !reflect.DeepEqual(fake.deleted, want) {
+		t.Errorf("deleted %v, want %v", fake.deleted, want)
+	}
+
+	r.DeleteVertexArray(&vao)
+	r.DeleteTexture(&tex)
+	prog := uint32(100)
+	r.DeleteProgram(&prog)
+	if r.Live() != 0 {
+		t.Errorf("Live() = %d after deleting everything", r.Live())
+	}
+	want = append(want, resource{RES_VAO, 1}, resource{RES_TEXTURE, 3}, resource{RES_PROGRAM, 100})
+	if !reflect.DeepEqual(fake.deleted, want) {
+		t.Errorf("deleted %v, want %v", fake.deleted, want)
+	}
+}
+
+func TestResourcesDoubleDelete(t *testing.T) {
+	fake := &fakeBackend{}
+	r := NewResources(fake)
+	vao := r.GenVertexArray()
+	id := vao
+	r.DeleteVertexArray(&vao)
+	r.DeleteVertexArray(&vao)
+	// Deleting by the old id again must not reach the backend either
+	r.DeleteVertexArray(&id)
+	if len(fake.deleted) != 1 {
+		t.Errorf("backend saw %d deletes, want 1: %v", len(fake.deleted), fake.deleted)
+	}
+	// Ids of the wrong kind are not tracked, so they are skipped too
+	vbo := r.GenBuffer()
+	asVao := vbo
+	r.DeleteVertexArray(&asVao)
+	if len(fake.deleted) != 1 || r.Live() != 1 {
+		t.Errorf("deleting a VBO id as a VAO reached the backend: %v", fake.deleted)
+	}
+}
+
+func TestResourcesFreeAll(t *testing.T) {
+	fake := &fakeBackend{}
+	r := NewResources(fake)
+	r.GenBuffer()
+	r.GenVertexArray()
+	tex := r.GenTexture()
+	r.TrackProgram(100)
+	r.GenBuffer()
+	r.DeleteTexture(&tex)
+	fake.deleted = nil
+
+	r.FreeAll()
+	want := []resource{
+		{RES_VBO, 4},
+		{RES_PROGRAM, 100},
+		{RES_VAO, 2},
+		{RES_VBO, 1},
+	}
+	if !reflect.DeepEqual(fake.deleted, want) {
+		t.Errorf("FreeAll deleted %v, want %v", fake.deleted, want)
+	}
+	if r.Live() != 0 {
+		t.Errorf("Live() = %d after FreeAll", r.Live())
+	}
+	fake.deleted = nil
+	r.FreeAll()
+	if len(fake.deleted) != 0 {
+		t.Errorf("second FreeAll deleted %v", fake.deleted)
+	}
+}
+
+func TestResourcesReportLeaks(t *testing.T) {
+	r := NewResources(&fakeBackend{})
+	var buf bytes.Buffer
+	if n := r.ReportLeaks(&buf); n != 0 || buf.Len() != 0 {
+		t.Errorf("ReportLeaks on an empty manager = %d, %q", n, buf.String())
+	}
+
+	vao := r.GenVertexArray()
+	r.GenBuffer()
+	r.TrackProgram(7)
+	r.DeleteVertexArray(&vao)
+	n := r.ReportLeaks(&buf)
+	if n != 2 {
+		t.Errorf("ReportLeaks = %d, want 2", n)
+	}
+	out := buf.String()
+	for _, want := range []string{"leaked VBO 2", "leaked program 7"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report %q is missing %q", out, want)
+		}
+	}
+	if strings.Contains(out, "VAO") {
+		t.Errorf("report %q lists the deleted VAO", out)
+	}
+	if lines := strings.Count(out, "\n"); lines != 2 {
+		t.Errorf("report has %d lines, want 2: %q", lines, out)
+	}
+}
+
+func TestCreationSite(t *testing.T) {
+	// Stands in for track, whose caller is the first frame kept
+	site := func() string { return creationSite() }()
+	first := strings.Split(site, " <- ")[0]
+	if !strings.HasPrefix(filepath.Base(first), "resources_test.go:") {
+		t.Errorf("creationSite() = %q, want it to start at this test", site)
+	}
+	if strings.Contains(site, "/resources.go:") || strings.Contains(site, "/layout.go:") {
+		t.Errorf("creationSite() = %q includes the resource manager", site)
+	}
+}
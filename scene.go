@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Node is a part of a scene, its transform is relative to its parent
+type Node struct {
+	Transform mgl32.Mat4
+	// What to draw at this node, nil for nodes which only group others
+	D        Drawable
+	Children []*Node
+	// Hidden nodes are not drawn, neither are their children
+	Hidden bool
+}
+
+func NewNode(transform mgl32.Mat4, d Drawable, children ...*Node) *Node {
+	return &Node{
+		Transform: transform,
+		D:         d,
+		Children:  children,
+	}
+}
+
+func (n *Node) Add(children ...*Node) {
+	n.Children = append(n.Children, children...)
+}
+
+// Removes all of the children of n
+func (n *Node) Clear() {
+	n.Children = n.Children[:0]
+}
+
+// Scene is everything drawn on the screen at once, eg. the menu or the game
+type Scene struct {
+	Root     *Node
+	Camera   *Camera
+	renderer Renderer
+	// Built by BVH when it is needed, nil after Invalidate
+	bvh *BVH
+}
+
+func NewScene(cam *Camera) *Scene {
+	return &Scene{
+		Root:   NewNode(mgl32.Ident4(), nil),
+		Camera: cam,
+	}
+}
+
+// Call this after adding, removing, moving or hiding nodes, or changing the
+// points of their shapes, so that Pick sees them where they are drawn
+func (s *Scene) Invalidate() {
+	s.bvh = nil
+}
+
+// Draws every visible node of the scene as seen from its camera
+func (s *Scene) Draw() {
+	s.submit(s.Root, mgl32.Ident4())
+	s.renderer.Flush(s.Camera)
+}
+
+func (s *Scene) submit(n *Node, parent mgl32.Mat4) {
+	if n.Hidden {
+		return
+	}
+	model := parent.Mul4(n.Transform)
+	if n.D != nil {
+		s.renderer.Submit(n.D, model)
+	}
+	for _, c := range n.Children {
+		s.submit(c, model)
+	}
+}
@@ -1,15 +1,17 @@
 package main
 
 import (
-	"fmt"
+	"container/list"
 	"github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/go-gl/glfw/v3.3/glfw"
 	"github.com/go-gl/mathgl/mgl32"
 	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
 	"golang.org/x/image/font/sfnt"
 	"golang.org/x/image/math/fixed"
 	"io/ioutil"
 	"math"
+	"sort"
 )
 
 var (
@@ -21,7 +23,10 @@ var (
 
 type Drawable interface {
 	Draw()
+	// Draws with the model matrix multiplied by parent
+	DrawAt(parent mgl32.Mat4)
 	GenVao()
+	Free()
 }
 
 type Point struct {
@@ -49,7 +54,7 @@ func (p *Point) Z() float32 {
 	return p.P[2]
 }
 func (p *Point) Dist(p1 *Point) float32 {
-	return float32(math.Sqrt(float64((p.X()-p1.X())*(p.X()-p1.X()) + (p.Y()+p1.Y())*(p.Y()+p1.Y())*(p.Y()+p1.Y()))))
+	return p.P.Sub(p1.P).Len()
 }
 
 /* Returns a point with x, y, z as its position with white color and normal in the
@@ -93,35 +98,39 @@ func PCNT(x, y, z, r, g, b, a, i, j, k, tx, ty float32) *Point {
 /* NOTE: This function returns a new Point with the given position */
 func (p *Point) SetP(x, y, z float32) *Point {
 	return &Point{P: mgl32.Vec3{x, y, z},
-		C: p.C,
-		N: p.N,
-		T: p.T,
+		C:         p.C,
+		N:         p.N,
+		T:         p.T,
+		Threshold: p.Threshold,
 	}
 }
 
 /* NOTE: This function returns a new Point with the given Color */
 func (p *Point) SetC(r, g, b, a float32) *Point {
 	return &Point{P: p.P,
-		C: mgl32.Vec4{r, g, b, a},
-		N: p.N,
-		T: p.T,
+		C:         mgl32.Vec4{r, g, b, a},
+		N:         p.N,
+		T:         p.T,
+		Threshold: p.Threshold,
 	}
 }
 
 /* NOTE: This function returns a new Point with the given Normal */
 func (p *Point) SetN(i, j, k float32) *Point {
 	return &Point{P: p.P,
-		C: p.C,
-		N: mgl32.Vec3{i, j, k},
-		T: p.T,
+		C:         p.C,
+		N:         mgl32.Vec3{i, j, k},
+		T:         p.T,
+		Threshold: p.Threshold,
 	}
 }
 
 func (p *Point) SetT(x, y float32) *Point {
 	return &Point{P: p.P,
-		C: p.C,
-		N: p.N,
-		T: mgl32.Vec2{x, y},
+		C:         p.C,
+		N:         p.N,
+		T:         mgl32.Vec2{x, y},
+		Threshold: p.Threshold,
 	}
 }
 
@@ -133,12 +142,39 @@ NOTE: This function returns the new points
 func (p *Point) MassOffset(pts ...*Point) []*Point {
 	Offseted := make([]*Point, len(pts))
 	for i, val := range pts {
-		Offseted[i] = P(0, 0, 0).SetP(val.X()+p.X(), val.Y()+p.Y(), val.Z()+p.Y())
-		Offseted[i].C, Offseted[i].N = val.C, val.N
+		Offseted[i] = val.SetP(val.X()+p.X(), val.Y()+p.Y(), val.Z()+p.Z())
 	}
 	return Offseted
 }
 
+// Returns the point t of the way from p to p1, every attribute is interpolated
+// NOTE: the normal is not normalized again
+func (p *Point) Lerp(p1 *Point, t float32) *Point {
+	return &Point{
+		P:         p.P.Add(p1.P.Sub(p.P).Mul(t)),
+		C:         p.C.Add(p1.C.Sub(p.C).Mul(t)),
+		N:         p.N.Add(p1.N.Sub(p.N).Mul(t)),
+		T:         p.T.Add(p1.T.Sub(p.T).Mul(t)),
+		Threshold: p.Threshold + (p1.Threshold-p.Threshold)*t,
+	}
+}
+
+// Returns the point moved by m, with its normal turned to match
+func (p *Point) Transform(m mgl32.Mat4) *Point {
+	q := *p
+	q.P = mgl32.TransformCoordinate(p.P, m)
+	// Normals go through the inverse transpose, so that scaling doesn't skew them
+	if n := m.Mat3().Inv().Transpose().Mul3x1(p.N); n.Len() != 0 {
+		q.N = n.Normalize()
+	}
+	return &q
+}
+
+// Returns the box around the positions of the points
+func PointsBounds(pts ...*Point) AABB {
+	return NewAABB(PointsToMglPos(pts...)...)
+}
+
 type Circle struct {
 	// Center point determines the center of the circle
 	// And the color of the center of the circle
@@ -147,6 +183,7 @@ type Circle struct {
 	Vbo      uint32
 	IsFilled bool
 	ModelMat *mgl32.Mat4
+	Material *Material
 	// r is the complete radius of the circle
 	// the alpha at r is 0
 	// t is threshold upto which the color of the circle
@@ -164,62 +201,54 @@ func NewCircle(center *Point, r, t float32, isFilled bool, modelMat mgl32.Mat4)
 	}
 }
 
-func (s *Circle) PointData() []byte {
-	arr := []byte{}
+// The triangle enclosing the circle, the fragment shader cuts the circle out of it
+func (s *Circle) Points() []*Point {
 	radius := s.R
 	factor := 3 + math.Sqrt2/2
-	for i := 0; i < 3; i++ {
+	pts := make([]*Point, 3)
+	for i := range pts {
 		x := radius * float32(math.Cos(math.Pi/2+float64(i)*2*math.Pi/3)*factor) * 1.1
 		y := radius * float32(math.Sin(math.Pi/2+float64(i)*2*math.Pi/3)*factor) * 1.1
-		floatBytes := Float32SlicetoBytes(PCNT(
+		pts[i] = PCNT(
 			x, y, 1,
 			s.Center.C[0], s.Center.C[1], s.Center.C[2], s.Center.C[3],
 			s.Center.N[0], s.Center.N[1], s.Center.N[2],
 			x, y,
-		).Arr())
-		fmt.Println(x, y)
-		arr = append(arr, floatBytes...)
-		arr = append(arr, Float32SlicetoBytes([]float32{s.T})...)
+		)
+		pts[i].Threshold = s.T
 	}
-	return arr
+	return pts
+}
+
+func (s *Circle) PointData() []byte {
+	return PointLayout.Pack(s.Points())
 }
 
 func (s *Circle) GenVao() {
-	data := s.PointData()
-	fmt.Println(float64(len(data)) / float64(pointByteSize))
-	var vbo uint32
-	// Generate the buffer for the Vertex data
-	gl.GenBuffers(1, &vbo)
-	gl.BindBuffer(gl.ARRAY_BUFFER, vbo)
-	// Fill the buffer with the Points data in our shape
-	gl.BufferData(gl.ARRAY_BUFFER, len(data), gl.Ptr(data), gl.STATIC_DRAW)
-	var vao uint32
-	// Generate our Vertex Array
-	gl.GenVertexArrays(1, &vao)
-	gl.BindVertexArray(vao)
-	gl.BindBuffer(gl.ARRAY_BUFFER, vbo)
-	// At index 0, Put all the Position data
-	gl.EnableVertexAttribArray(0)
-	gl.VertexAttribPointer(0, 3, gl.FLOAT, false, pointByteSize, nil)
-	// At index 1, Put all the Color data
-	gl.EnableVertexAttribArray(1)
-	gl.VertexAttribPointer(1, 4, gl.FLOAT, false, pointByteSize, gl.PtrOffset(12))
-	// At index 2, Put all the Normal's data
-	gl.EnableVertexAttribArray(2)
-	gl.VertexAttribPointer(2, 3, gl.FLOAT, false, pointByteSize, gl.PtrOffset(28))
-	// At index 3, Put the texture coords
-	gl.EnableVertexAttribArray(3)
-	gl.VertexAttribPointer(3, 2, gl.FLOAT, false, pointByteSize, gl.PtrOffset(40))
-	// At index 4, Put texture coordinate threshold after which color fades
-	gl.EnableVertexAttribArray(4)
-	gl.VertexAttribPointer(4, 1, gl.FLOAT, false, pointByteSize, gl.PtrOffset(48))
-	// store the Vao and Vbo representatives in the shape
-	s.Vbo = vbo
-	s.Vao = vao
+	s.Vao, s.Vbo = PointLayout.GenVao(s.PointData(), gl.STATIC_DRAW)
+}
+
+// Releases the Vao and Vbo of the circle, it can be generated again with GenVao
+func (s *Circle) Free() {
+	GLResources.DeleteVertexArray(&s.Vao)
+	GLResources.DeleteBuffer(&s.Vbo)
+}
+
+func (s *Circle) material() *Material {
+	if s.Material == nil {
+		return DefaultMaterial
+	}
+	return s.Material
 }
 
 func (s *Circle) Draw() {
-	UpdateUniformMat4fv("model", program, &s.ModelMat[0])
+	s.DrawAt(mgl32.Ident4())
+}
+
+func (s *Circle) DrawAt(parent mgl32.Mat4) {
+	m := s.material()
+	m.Use()
+	m.Prog.Mat4("model", parent.Mul4(*s.ModelMat))
 	gl.BindVertexArray(s.Vao)
 	gl.DrawArrays(gl.TRIANGLES, 0, 3)
 }
@@ -241,32 +270,72 @@ func NewRay(RayType uint8, modelMat mgl32.Mat4, points ...mgl32.Vec3) *Ray {
 	}
 }
 
-// Takes a shape and check for collison the the ray r, if there is collision
-// IsColliding is true, CollidingAt is where the collision happend and
+// Where a ray went through a triangle
+type RayHit struct {
+	At mgl32.Vec3
+	// Distance of At from the first point of the ray
+	Dist float32
+	// Which of the rays in Ray hit, in the order they are constructed in
+	Ray int
+	// The triangle which was hit, in world space
+	Tri [3]mgl32.Vec3
+}
+
+// Returns the rays described by r as pairs of points, every ray starts at
+// the first point and goes on through the second one
+func (r *Ray) Segments() [][2]mgl32.Vec3 {
+	var segs [][2]mgl32.Vec3
+	switch r.Type {
+	case RAY_TYPE_CENTERED:
+		for i := 1; i < len(r.Pts); i++ {
+			segs = append(segs, [2]mgl32.Vec3{*r.Pts[0], *r.Pts[i]})
+		}
+	case RAY_TYPE_STRIP:
+		// An odd point out at the end makes no ray
+		for i := 0; i+1 < len(r.Pts); i += 2 {
+			segs = append(segs, [2]mgl32.Vec3{*r.Pts[i], *r.Pts[i+1]})
+		}
+	}
+	return segs
+}
+
+// Same as PolyCollideAt with the identity as parent
+func (r *Ray) PolyCollide(s *Shape) []RayHit {
+	return r.PolyCollideAt(s, mgl32.Ident4())
+}
+
+// Checks every ray of r against the triangles of s transformed by
+// parent and then its ModelMat, returns the hits sorted by distance, nearest first
 // s can only be of type TRIANGLES, TRIANGLE_STRIP, TRIANGLE_FAN
-func (r *Ray) PolyCollide(s *Shape) (IsColliding bool, CollidingAt []*mgl32.Vec3, CollTri [][3]*mgl32.Vec3) {
+func (r *Ray) PolyCollideAt(s *Shape, parent mgl32.Mat4) []RayHit {
+	if s.Triangulated == nil {
+		s.Triangulate()
+	}
+	model := parent.Mul4(s.ModelMat)
 	triang := make([]mgl32.Vec3, len(s.Triangulated))
 	for i, v := range s.Triangulated {
-		triang[i] = mgl32.TransformCoordinate(*v, s.ModelMat)
+		triang[i] = mgl32.TransformCoordinate(*v, model)
 	}
-	switch r.Type {
-	case RAY_TYPE_CENTERED:
-		InitVec := r.Pts[0]
-		for i := 1; i < len(r.Pts); i++ {
-			for j := 0; j < len(triang)/3; j++ {
-				IsItColling, WhereIsIt := RayTriangleCollision([2]*mgl32.Vec3{InitVec, r.Pts[i]},
-					[3]*mgl32.Vec3{&triang[3*j], &triang[3*j+1], &triang[3*j+2]},
-				)
-				if !IsColliding {
-					IsColliding = IsItColling
-					CollidingAt = append(CollidingAt, &WhereIsIt)
-					CollTri = append(CollTri, [3]*mgl32.Vec3{&triang[3*j], &triang[3*j+1], &triang[3*j+2]})
-				}
+	var hits []RayHit
+	for i, seg := range r.Segments() {
+		dir := seg[1].Sub(seg[0])
+		if dir.Len() == 0 {
+			// Both points are the same, there is no direction to go in
+			continue
+		}
+		dir = dir.Normalize()
+		for j := 0; j+2 < len(triang); j += 3 {
+			tri := [3]mgl32.Vec3{triang[j], triang[j+1], triang[j+2]}
+			ok, at := RayTriangleCollision([2]*mgl32.Vec3{&seg[0], &dir},
+				[3]*mgl32.Vec3{&tri[0], &tri[1], &tri[2]},
+			)
+			if ok {
+				hits = append(hits, RayHit{at, at.Sub(seg[0]).Len(), i, tri})
 			}
-
 		}
 	}
-	return IsColliding, CollidingAt, CollTri
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Dist < hits[j].Dist })
+	return hits
 }
 
 type Shape struct {
@@ -275,22 +344,35 @@ type Shape struct {
 	ModelMat     mgl32.Mat4
 	Vao          uint32
 	Vbo          uint32
-	Prog         uint32
 	Type         uint32
 	Primitives   int32
 	Triangulated []*mgl32.Vec3
-}
-
-func NewShape(mat mgl32.Mat4, prog uint32, pts ...*Point) *Shape {
+	// What to draw the shape with, DefaultMaterial if nil
+	Material *Material
+	// One of STATIC_DRAW, DYNAMIC_DRAW or STREAM_DRAW, 0 means STATIC_DRAW
+	Usage uint32
+	// Number of bytes allocated in the Vbo, can be more than the points need
+	Capacity int
+	// Cached box around Pts in model space
+	bounds      AABB
+	boundsValid bool
+}
+
+func NewShape(mat mgl32.Mat4, material *Material, pts ...*Point) *Shape {
 	return &Shape{
 		Pts:      pts,
 		ModelMat: mat,
-		Prog:     prog,
+		Material: material,
 	}
 }
 
 func (s *Shape) Triangulate() {
-	var triang []*mgl32.Vec3
+	triang := []*mgl32.Vec3{}
+	if len(s.Pts) < 3 {
+		// Not even one triangle
+		s.Triangulated = triang
+		return
+	}
 	switch s.Type {
 	case gl.TRIANGLES:
 		triang = make([]*mgl32.Vec3, len(s.Pts))
@@ -320,6 +402,11 @@ func (s *Shape) Triangulate() {
 			prevV = &s.Pts[i].P
 
 		}
+	case gl.LINE_LOOP:
+		// The outline of a polygon, fill it in
+		for _, p := range TriangulatePolygon(s.Pts) {
+			triang = append(triang, &p.P)
+		}
 	}
 	s.Triangulated = triang
 }
@@ -336,34 +423,24 @@ func (p *Point) Arr() []float32 {
 // Do not use this function frequently,
 // Instead use ModelMat to transform the shapes
 func (p *Point) ReScale(x, y, z float32) *Point {
-	return &Point{
-		P: mgl32.Vec3{p.X() * x, p.Y() * y, p.Z() * z},
-		C: p.C,
-		N: p.N,
-	}
+	return p.SetP(p.X()*x, p.Y()*y, p.Z()*z)
 }
 
 // Do not use this function frequently,
 // Instead use ModelMat to transform the shapes
 func (s *Shape) ReScale(x, y, z float32) *Shape {
-	S := NewShape(mgl32.Ident4(), program)
+	S := NewShape(mgl32.Ident4(), s.Material)
 	ps := make([]*Point, len(s.Pts))
 	for i, p := range s.Pts {
 		ps[i] = p.ReScale(x, y, z)
 	}
 	S.Pts = ps
+	S.SetTypes(s.Type)
 	return S
 }
 
 func (s *Shape) PointData() []byte {
-	var data []byte
-	for _, p := range s.Pts {
-		dataFloat := make([]float32, 0)
-		dataFloat = append(dataFloat, p.Arr()...)
-		dataFloat = append(dataFloat, p.Threshold)
-		data = append(data, Float32SlicetoBytes(dataFloat)...)
-	}
-	return data
+	return PointLayout.Pack(s.Pts)
 }
 
 func (s *Shape) TransformData() []float32 {
@@ -376,39 +453,32 @@ func (s *Shape) TransformData() []float32 {
 }
 
 func (s *Shape) GenVao() {
-	floatBytes := s.PointData()
-	fmt.Println(float64(len(floatBytes)) / float64(pointByteSize))
-	var vbo uint32
-	// Generate the buffer for the Vertex data
-	gl.GenBuffers(1, &vbo)
-	gl.BindBuffer(gl.ARRAY_BUFFER, vbo)
-	// Fill the buffer with the Points data in our shape
-	// 49bytes = Bytes of Position + Color + Normal + Texture + byte for roundedness
-	gl.BufferData(gl.ARRAY_BUFFER, 49*len(s.Pts), gl.Ptr(floatBytes), gl.STATIC_DRAW)
-	var vao uint32
-	// Generate our Vertex Array
-	gl.GenVertexArrays(1, &vao)
-	gl.BindVertexArray(vao)
-	gl.BindBuffer(gl.ARRAY_BUFFER, vbo)
-	// At index 0, Put all the Position data
-	gl.EnableVertexAttribArray(0)
-	gl.VertexAttribPointer(0, 3, gl.FLOAT, false, pointByteSize, nil)
-	// At index 1, Put all the Color data
-	gl.EnableVertexAttribArray(1)
-	gl.VertexAttribPointer(1, 4, gl.FLOAT, false, pointByteSize, gl.PtrOffset(12))
-	// At index 2, Put all the Normal's data
-	gl.EnableVertexAttribArray(2)
-	gl.VertexAttribPointer(2, 3, gl.FLOAT, false, pointByteSize, gl.PtrOffset(28))
-	// At index 3, Put all the Texture Coords's data
-	gl.EnableVertexAttribArray(3)
-	gl.VertexAttribPointer(3, 2, gl.FLOAT, false, pointByteSize, gl.PtrOffset(40))
-	// At index 4, Put the texture coords threshold after which color fades
-	gl.EnableVertexAttribArray(4)
-	gl.VertexAttribPointer(4, 1, gl.FLOAT, false, pointByteSize, gl.PtrOffset(48))
-	// store the Vao and Vbo representatives in the shape
-	s.Vbo = vbo
-	s.Vao = vao
+	s.InvalidateBounds()
+	data := s.PointData()
+	s.Capacity = len(data)
+	s.Vao, s.Vbo = PointLayout.GenVao(data, s.usage())
+}
+
+// Returns the box around the points of the shape, before ModelMat is applied
+func (s *Shape) Bounds() AABB {
+	if !s.boundsValid {
+		s.bounds = PointsBounds(s.Pts...)
+		s.boundsValid = true
+	}
+	return s.bounds
+}
+
+// Returns the box around the shape when drawn at parent
+// A shape can be drawn at many places at once, so this isn't cached, the BVH
+// keeps the box of every place instead
+func (s *Shape) WorldBounds(parent mgl32.Mat4) AABB {
+	return s.Bounds().Transform(parent.Mul4(s.ModelMat))
+}
 
+// Call this after changing Pts without calling Update or GenVao
+func (s *Shape) InvalidateBounds() {
+	s.boundsValid = false
+	s.Triangulated = nil
 }
 
 func (s *Shape) SetTypes(mode uint32) {
@@ -416,144 +486,302 @@ func (s *Shape) SetTypes(mode uint32) {
 	s.Primitives = int32(len(s.Pts))
 }
 
+// Sets the usage hint of the Vbo, call this before GenVao
+// Shapes which change every frame should use DYNAMIC_DRAW or STREAM_DRAW
+func (s *Shape) SetUsage(usage uint32) {
+	s.Usage = usage
+}
+
+func (s *Shape) usage() uint32 {
+	if s.Usage == 0 {
+		return gl.STATIC_DRAW
+	}
+	return s.Usage
+}
+
+// Uploads the current Pts to the existing Vbo without recreating the Vao,
+// the Vbo grows by doubling when the points don't fit in it anymore
+func (s *Shape) Update() {
+	if s.Vao == 0 {
+		s.GenVao()
+		return
+	}
+	s.InvalidateBounds()
+	data := s.PointData()
+	gl.BindBuffer(gl.ARRAY_BUFFER, s.Vbo)
+	if len(data) > s.Capacity {
+		capacity := s.Capacity
+		if capacity == 0 {
+			capacity = int(PointLayout.Stride())
+		}
+		for capacity < len(data) {
+			capacity *= 2
+		}
+		gl.BufferData(gl.ARRAY_BUFFER, capacity, nil, s.usage())
+		s.Capacity = capacity
+	} else if s.usage() == gl.STREAM_DRAW {
+		// Orphan the old storage so that we don't wait for draws still reading it
+		gl.BufferData(gl.ARRAY_BUFFER, s.Capacity, nil, s.usage())
+	}
+	if len(data) > 0 {
+		gl.BufferSubData(gl.ARRAY_BUFFER, 0, len(data), gl.Ptr(data))
+	}
+	s.Primitives = int32(len(s.Pts))
+}
+
+// Releases the Vao and Vbo of the shape, it can be generated again with GenVao
 func (s *Shape) Free() {
-	gl.DeleteBuffers(1, &s.Vao)
-	gl.DeleteVertexArrays(1, &s.Vao)
+	GLResources.DeleteVertexArray(&s.Vao)
+	GLResources.DeleteBuffer(&s.Vbo)
+}
+
+func (s *Shape) material() *Material {
+	if s.Material == nil {
+		return DefaultMaterial
+	}
+	return s.Material
 }
 
 func (s *Shape) Draw() {
-	UpdateUniformMat4fv("model", program, &s.ModelMat[0])
+	s.DrawAt(mgl32.Ident4())
+}
+
+func (s *Shape) DrawAt(parent mgl32.Mat4) {
+	m := s.material()
+	m.Use()
+	m.Prog.Mat4("model", parent.Mul4(s.ModelMat))
 	gl.BindVertexArray(s.Vao)
 	gl.DrawArrays(s.Type, 0, s.Primitives)
 }
 
+// Button is a labelled rectangle in screen space, the space of NewOverlayCamera,
+// which calls CB when clicked, see UI
 type Button struct {
 	Win       *glfw.Window
 	Geometry  *Shape
 	Text      string
 	TextShape *Shape
+	Font      *Font
 	CB        Callback
+	// Colors of the rectangle when it is left alone, under the cursor and held down
+	Color, HoverColor, PressColor mgl32.Vec4
+	Hovered, Pressed              bool
+	// Disabled buttons are grayed out and don't react to the mouse
+	Disabled bool
+	// Font.Evictions when the text was laid out
+	evictions int
 }
 
-type Callback func(w *glfw.Window, MX, MY float64, click3D []*mgl32.Vec3, NearTri [][3]*mgl32.Vec3)
+type Callback func(b *Button)
 
 type Font struct {
-	GlyphMap map[rune]*Shape
-	TtfFont  *sfnt.Font
-	OgScale  fixed.Int26_6
-}
-
+	TtfFont *sfnt.Font
+	OgScale fixed.Int26_6
+	// Coverage of every cached glyph, sampled by Material
+	Atlas    *GlyphAtlas
+	Material *Material
+	// Drawn for runes the font doesn't have
+	Missing *Glyph
+	// Glyphs loaded so far, the least recently used one is dropped to make room
+	// for a new one once there are MaxGlyphs of them
+	glyphs    map[rune]*Glyph
+	lru       *list.List
+	MaxGlyphs int
+	// Runes placed by the Layout in progress, they aren't evicted until it is done
+	inUse map[rune]bool
+	// Number of glyphs dropped so far, text shapes made before a change may
+	// show the wrong glyphs and should be made again
+	Evictions int
+}
+
+// Returns a button covering x1, y1 to x2, y2 in screen space with text centered on it
+// Call GenVao on it before drawing it
 func NewButton(x1, y1, x2, y2 float32, w *glfw.Window, text string, cb Callback, font *Font) *Button {
 	b := new(Button)
-	b.Geometry = NewShape(mgl32.Ident4(), program,
-		PC(x1, y1, 1, 1, 0, 1, 1),
-		PC(x1, y2, 1, 1, 0, 1, 1),
-		PC(y2, x1, 1, 1, 0, 1, 1),
-		PC(x2, y2, 1, 1, 0, 1, 1),
+	b.Color = mgl32.Vec4{0.2, 0.2, 0.2, 0.8}
+	b.HoverColor = mgl32.Vec4{0.35, 0.35, 0.35, 0.9}
+	b.PressColor = mgl32.Vec4{0.1, 0.5, 0.1, 0.9}
+	// Around the rectangle, so that it can be hit tested with PtPolyCollision
+	b.Geometry = NewShape(mgl32.Ident4(), DefaultMaterial,
+		P(x1, y1, 1),
+		P(x2, y1, 1),
+		P(x2, y2, 1),
+		P(x1, y2, 1),
 	)
-	b.Geometry.SetTypes(gl.TRIANGLE_STRIP)
+	b.Geometry.SetTypes(gl.TRIANGLE_FAN)
+	b.Geometry.SetUsage(gl.DYNAMIC_DRAW)
 	b.Win = w
 	b.Text = text
+	b.Font = font
 	b.CB = cb
-	b.TextShape = TextToShape(font, text)
-	b.TextShape.ModelMat = mgl32.Translate3D(x1-x2, (y1-y2)/2, 0)
-	ShapePrint(b.Geometry)
+	b.TextShape = b.layoutText()
+	b.paint()
 	return b
 }
 
+// Returns the shape of the text, fit in the middle of the rectangle with some room around it
+func (b *Button) layoutText() *Shape {
+	text, bounds := TextToShapeOpts(b.Font, b.Text, TextOptions{Align: ALIGN_CENTER})
+	b.evictions = b.Font.Evictions
+	rect := PointsBounds(b.Geometry.Pts...)
+	w, h := rect.Max.X()-rect.Min.X(), rect.Max.Y()-rect.Min.Y()
+	center := rect.Center()
+	size := bounds.Max.Sub(bounds.Min)
+	scale := 0.6 * h / size.Y()
+	if size.X()*scale > 0.9*w {
+		scale = 0.9 * w / size.X()
+	}
+	text.ModelMat = mgl32.Translate3D(center.X()-size.X()*scale/2, center.Y()+size.Y()*scale/2, 0).
+		Mul4(mgl32.Scale3D(scale, scale, 1))
+	return text
+}
+
+// Changes the text on the button, the old text shape is freed
+func (b *Button) SetText(text string) {
+	b.Text = text
+	generated := b.TextShape.Vao != 0
+	b.TextShape.Free()
+	b.TextShape = b.layoutText()
+	if generated {
+		b.TextShape.GenVao()
+	}
+}
+
+// Lays the text out again if glyphs were dropped from the atlas since it was,
+// their cells may hold other glyphs by now, returns whether it did
+func (b *Button) refreshText() bool {
+	if b.Font.Evictions == b.evictions {
+		return false
+	}
+	b.SetText(b.Text)
+	return true
+}
+
+// Reports whether pt, in screen space, is on the button
+func (b *Button) Contains(pt *Point) bool {
+	return PtPolyCollision(pt, b.Geometry)
+}
+
+// Colors the rectangle for the state the button is in
+func (b *Button) paint() {
+	c := b.Color
+	switch {
+	case b.Disabled:
+		c = mgl32.Vec4{c[0] / 2, c[1] / 2, c[2] / 2, c[3]}
+	case b.Pressed:
+		c = b.PressColor
+	case b.Hovered:
+		c = b.HoverColor
+	}
+	for i, p := range b.Geometry.Pts {
+		b.Geometry.Pts[i] = p.SetC(c[0], c[1], c[2], c[3])
+	}
+	if b.Geometry.Vao != 0 {
+		b.Geometry.Update()
+	}
+}
+
+// Sets the state of the button, repainting it only if it changed
+func (b *Button) setState(hovered, pressed bool) {
+	if b.Disabled {
+		hovered, pressed = false, false
+	}
+	if hovered == b.Hovered && pressed == b.Pressed {
+		return
+	}
+	b.Hovered, b.Pressed = hovered, pressed
+	b.paint()
+}
+
+func (b *Button) SetDisabled(disabled bool) {
+	b.Disabled = disabled
+	b.Hovered, b.Pressed = false, false
+	b.paint()
+}
+
 func (b *Button) Draw() {
 	b.Geometry.Draw()
 	b.TextShape.Draw()
 }
 
+func (b *Button) DrawAt(parent mgl32.Mat4) {
+	b.Geometry.DrawAt(parent)
+	b.TextShape.DrawAt(parent)
+}
+
 func (b *Button) GenVao() {
 	b.Geometry.GenVao()
 	b.TextShape.GenVao()
 }
 
+func (b *Button) Free() {
+	b.Geometry.Free()
+	b.TextShape.Free()
+}
+
+// Frees the atlas, shapes made by TextToShape have to be freed on their own
+func (f *Font) Free() {
+	f.Atlas.Free()
+}
+
 // This function creates a new Font to be used by TextToShape function
-// Supply the characters to load in runes
+// The characters in runes are loaded up front, any others the first time they are used
 // NOTE: This function is not very memory efficient, donot call this in loop
 func NewFont(path string, runes string, OgScale fixed.Int26_6) *Font {
+	f, err := LoadFont(path, runes, OgScale)
+	orDie(err)
+	return f
+}
+
+// Same as NewFont, but returns an error if the file can't be read or isn't a TTF or OTF font
+func LoadFont(path string, runes string, OgScale fixed.Int26_6) (*Font, error) {
+	fontFile, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFont(fontFile, runes, OgScale)
+}
+
+// Returns the Go font, which is built into the client
+func NewDefaultFont(runes string, OgScale fixed.Int26_6) *Font {
+	f, err := ParseFont(goregular.TTF, runes, OgScale)
+	orDie(err)
+	return f
+}
+
+// Creates a Font out of the contents of a TTF or OTF file, see NewFont
+func ParseFont(fontFile []byte, runes string, OgScale fixed.Int26_6) (*Font, error) {
 	// Inittialize a new Font struct
 	f := new(Font)
 	f.OgScale = OgScale
-	f.GlyphMap = make(map[rune]*Shape)
-	// Read and parse the file provided
-	fontFile, err := ioutil.ReadFile(path)
-	orDie(err)
+	f.glyphs = make(map[rune]*Glyph)
+	f.lru = list.New()
+	f.MaxGlyphs = DefaultMaxGlyphs
 	ttFont, err := sfnt.Parse(fontFile)
-	orDie(err)
+	if err != nil {
+		return nil, err
+	}
 	f.TtfFont = ttFont
 	// If Default scale is 0, set it to a default value
 	if f.OgScale == 0 {
 		f.OgScale = fixed.I(64)
 	}
 	boundR, err := ttFont.Bounds(nil, f.OgScale, font.HintingNone)
-	orDie(err)
+	if err != nil {
+		return nil, err
+	}
 	bound := boundR.Max.Sub(boundR.Min)
 	maxX, maxY := bound.X.Round(), bound.Y.Round()
 
-	// Get the glyphs from rune 0 to 512 and create shapes out of them
-	// and store them in the Font struct
-	for _, i := range runes {
-		// Initialize a new glyph for rune i, with the provided scale and no hinting
-		glyph := &sfnt.Buffer{}
-		I, err := ttFont.GlyphIndex(glyph, rune(i))
-		orDie(err)
-		segs, err := ttFont.LoadGlyph(glyph, I, f.OgScale, nil)
-		// Add the glyph to Font if needed elesewhere
-		f.GlyphMap[rune(i)] = NewShape(mgl32.Ident4(), program)
-		// If the given rune has no shape in it, then give it a line
-		// This happens in case of space, escape codes and invalid characters
-		if len(segs) == 0 {
-			f.GlyphMap[rune(i)].Pts = make([]*Point, 2)
-			f.GlyphMap[rune(i)].Pts[0] = P(-1, -1, 1)
-			f.GlyphMap[rune(i)].Pts[1] = P(1, -1, 1)
-		} else {
-			// Get the bounds of the glyph
-			// Make a point to store the coords of SegmentOpMoveTo
-			prevP := P(0, 0, 0)
-			for _, val := range segs {
-				// Scale its coords to -1 to 1
-				x0, y0 := -float32(val.Args[0].X.Round())/float32(maxX), -float32(val.Args[0].Y.Round())/float32(maxY)
-				x1, y1 := -float32(val.Args[1].X.Round())/float32(maxX), -float32(val.Args[1].Y.Round())/float32(maxY)
-				x2, y2 := -float32(val.Args[2].X.Round())/float32(maxX), -float32(val.Args[2].Y.Round())/float32(maxY)
-				//fmt.Println(x1, y1)
-				switch val.Op {
-
-				case sfnt.SegmentOpMoveTo:
-					prevP = P(x0, y0, 1)
-				case sfnt.SegmentOpLineTo:
-					f.GlyphMap[rune(i)].Pts = append(f.GlyphMap[rune(i)].Pts,
-						P(prevP.X(), prevP.Y(), 1),
-						P(x0, y0, 1))
-					prevP = P(x0, y0, 1)
-				case sfnt.SegmentOpQuadTo:
-					f.GlyphMap[rune(i)].Pts = append(f.GlyphMap[rune(i)].Pts,
-						LineStripToSeg(BezCurve(8/float32(f.OgScale),
-							P(prevP.X(), prevP.Y(), 1),
-							P(x0, y0, 1),
-							P(x1, y1, 1))...)...)
-
-					prevP = P(x1, y1, 1)
-
-				case sfnt.SegmentOpCubeTo:
-					f.GlyphMap[rune(i)].Pts = append(f.GlyphMap[rune(i)].Pts,
-						LineStripToSeg(CubicBezCurve(8/float32(f.OgScale),
-							P(prevP.X(), prevP.Y(), 1),
-							P(x0, y0, 1),
-							P(x1, y1, 1),
-							P(x2, y2, 1))...)...)
-
-					prevP = P(x2, y2, 1)
-				}
-			}
-		}
-
-		f.GlyphMap[rune(i)].SetTypes(gl.LINES)
-		//	f.GlyphMap[rune(i)].GenVao()
-		orDie(err)
+	// Glyphs are drawn as quads textured from the atlas, every glyph fits in the bounds of the font
+	// One more cell for the glyph drawn in place of missing runes
+	f.Atlas = NewGlyphAtlas(maxX, maxY, f.MaxGlyphs+1)
+	f.Material = NewMaterial(DefaultMaterial.Prog)
+	f.Material.Texture = f.Atlas.Texture
+	// Glyph 0 is the .notdef glyph, usually a box
+	f.Missing, _ = f.loadGlyph(0)
+	for _, r := range runes {
+		f.Glyph(r)
 	}
-	return f
+	return f, nil
 }
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// A shape of separate triangles parallel to z = 0 at the given heights
+func flatTriangles(zs ...float32) *Shape {
+	var pts []*Point
+	for _, z := range zs {
+		pts = append(pts, P(-1, -1, z), P(1, -1, z), P(0, 1, z))
+	}
+	s := NewShape(mgl32.Ident4(), nil, pts...)
+	s.SetTypes(gl.TRIANGLES)
+	return s
+}
+
+func TestRaySegments(t *testing.T) {
+	pts := []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {2, 0, 0}, {3, 0, 0}, {4, 0, 0}}
+	seg := func(a, b int) [2]mgl32.Vec3 { return [2]mgl32.Vec3{pts[a], pts[b]} }
+	cases := []struct {
+		name     string
+		rayType  uint8
+		n        int
+		segments [][2]mgl32.Vec3
+	}{
+		{"centered single point", RAY_TYPE_CENTERED, 1, nil},
+		{"centered pair", RAY_TYPE_CENTERED, 2, [][2]mgl32.Vec3{seg(0, 1)}},
+		{"centered", RAY_TYPE_CENTERED, 4, [][2]mgl32.Vec3{seg(0, 1), seg(0, 2), seg(0, 3)}},
+		{"strip single point", RAY_TYPE_STRIP, 1, nil},
+		{"strip", RAY_TYPE_STRIP, 4, [][2]mgl32.Vec3{seg(0, 1), seg(2, 3)}},
+		{"strip odd trailing point", RAY_TYPE_STRIP, 5, [][2]mgl32.Vec3{seg(0, 1), seg(2, 3)}},
+	}
+	for _, c := range cases {
+		got := NewRay(c.rayType, mgl32.Ident4(), pts[:c.n]...).Segments()
+		if len(got) != len(c.segments) {
+			t.Errorf("%s: %d segments, want %d", c.name, len(got), len(c.segments))
+			continue
+		}
+		for i := range got {
+			if got[i] != c.segments[i] {
+				t.Errorf("%s: segment %d is %v, want %v", c.name, i, got[i], c.segments[i])
+			}
+		}
+	}
+}
+
+func TestPolyCollide(t *testing.T) {
+	cases := []struct {
+		name  string
+		shape *Shape
+		ray   *Ray
+		// Distances of the expected hits, nearest first
+		dists []float32
+		// Which ray of the Ray made each hit
+		rays []int
+	}{
+		{
+			"miss",
+			flatTriangles(0),
+			NewRay(RAY_TYPE_CENTERED, mgl32.Ident4(), mgl32.Vec3{5, 5, 1}, mgl32.Vec3{5, 5, 0}),
+			nil, nil,
+		},
+		{
+			"sorted by distance",
+			flatTriangles(-2, 0, -1),
+			NewRay(RAY_TYPE_CENTERED, mgl32.Ident4(), mgl32.Vec3{0, 0, 5}, mgl32.Vec3{0, 0, 4}),
+			[]float32{5, 6, 7}, []int{0, 0, 0},
+		},
+		{
+			// The second point is only a direction, hits beyond it count
+			"second point before the hit",
+			flatTriangles(0),
+			NewRay(RAY_TYPE_CENTERED, mgl32.Ident4(), mgl32.Vec3{0, 0, 5}, mgl32.Vec3{0, 0, 4.5}),
+			[]float32{5}, []int{0},
+		},
+		{
+			"behind the origin",
+			flatTriangles(0, 2),
+			NewRay(RAY_TYPE_CENTERED, mgl32.Ident4(), mgl32.Vec3{0, 0, 1}, mgl32.Vec3{0, 0, 0.5}),
+			[]float32{1}, []int{0},
+		},
+		{
+			"centered rays from one origin",
+			flatTriangles(0),
+			NewRay(RAY_TYPE_CENTERED, mgl32.Ident4(),
+				mgl32.Vec3{0, 0, 3}, mgl32.Vec3{0, 0, 2}, mgl32.Vec3{0, 0, 4}, mgl32.Vec3{9, 0, 3}),
+			[]float32{3}, []int{0},
+		},
+		{
+			"strip rays",
+			flatTriangles(0),
+			NewRay(RAY_TYPE_STRIP, mgl32.Ident4(),
+				mgl32.Vec3{0, 0, 3}, mgl32.Vec3{0, 0, 2},
+				mgl32.Vec3{0, 0, -1}, mgl32.Vec3{0, 0, 0},
+				// Would hit, but has no second point
+				mgl32.Vec3{0, 0, 2}),
+			[]float32{1, 3}, []int{1, 0},
+		},
+		{
+			"zero length ray",
+			flatTriangles(0),
+			NewRay(RAY_TYPE_CENTERED, mgl32.Ident4(), mgl32.Vec3{0, 0, 3}, mgl32.Vec3{0, 0, 3}),
+			nil, nil,
+		},
+	}
+	for _, c := range cases {
+		hits := c.ray.PolyCollide(c.shape)
+		if len(hits) != len(c.dists) {
+			t.Errorf("%s: %d hits, want %d: %v", c.name, len(hits), len(c.dists), hits)
+			continue
+		}
+		for i, h := range hits {
+			for _, f := range h.At {
+				if math.IsNaN(float64(f)) {
+					t.Errorf("%s: hit %d is at NaN: %v", c.name, i, h.At)
+				}
+			}
+			if math.Abs(float64(h.Dist-c.dists[i])) > 1e-5 {
+				t.Errorf("%s: hit %d is %v away, want %v", c.name, i, h.Dist, c.dists[i])
+			}
+			if h.Ray != c.rays[i] {
+				t.Errorf("%s: hit %d is from ray %d, want %d", c.name, i, h.Ray, c.rays[i])
+			}
+			if h.At[2] != h.Tri[0][2] {
+				t.Errorf("%s: hit %d at %v is not on its triangle %v", c.name, i, h.At, h.Tri)
+			}
+		}
+	}
+}
+
+// Point with every attribute set to something finite, quick's own floats
+// go up to MaxFloat32 which overflows as soon as two are added
+type quickPoint struct {
+	*Point
+}
+
+func (quickPoint) Generate(r *rand.Rand, size int) reflect.Value {
+	f := func() float32 { return (r.Float32()*2 - 1) * 100 }
+	p := PCNT(f(), f(), f(), r.Float32(), r.Float32(), r.Float32(), r.Float32(),
+		f(), f(), f(), r.Float32(), r.Float32())
+	p.Threshold = r.Float32()
+	return reflect.ValueOf(quickPoint{p})
+}
+
+// Everything but the position is the same
+func sameAttribs(p, q *Point) bool {
+	return p.C == q.C && p.N == q.N && p.T == q.T && p.Threshold == q.Threshold
+}
+
+// Compares within an absolute error, mgl32's thresholds are relative and
+// fail on values near 0 left over from subtracting big ones
+func near(a, b []float32) bool {
+	for i := range a {
+		if math.Abs(float64(a[i]-b[i])) > 1e-4 {
+			return false
+		}
+	}
+	return true
+}
+
+func approxPoint(p, q *Point) bool {
+	return near(p.P[:], q.P[:]) && near(p.C[:], q.C[:]) && near(p.N[:], q.N[:]) &&
+		near(p.T[:], q.T[:]) && near([]float32{p.Threshold}, []float32{q.Threshold})
+}
+
+func checkProperty(t *testing.T, name string, f interface{}) {
+	if err := quick.Check(f, nil); err != nil {
+		t.Errorf("%s: %v", name, err)
+	}
+}
+
+func TestPointProperties(t *testing.T) {
+	checkProperty(t, "Dist is symmetric and non-negative", func(p, q quickPoint) bool {
+		d := p.Dist(q.Point)
+		return d >= 0 && d == q.Dist(p.Point) && p.Dist(p.Point) == 0
+	})
+	checkProperty(t, "Dist is the length of the difference", func(p, q quickPoint) bool {
+		dx, dy, dz := float64(p.X()-q.X()), float64(p.Y()-q.Y()), float64(p.Z()-q.Z())
+		want := float32(math.Sqrt(dx*dx + dy*dy + dz*dz))
+		return mgl32.FloatEqualThreshold(p.Dist(q.Point), want, 1e-4)
+	})
+	checkProperty(t, "Lerp at 0 and 1 gives the endpoints", func(p, q quickPoint) bool {
+		return *p.Lerp(q.Point, 0) == *p.Point && approxPoint(p.Lerp(q.Point, 1), q.Point)
+	})
+	checkProperty(t, "Lerp at 0.5 is halfway", func(p, q quickPoint) bool {
+		mid := p.Lerp(q.Point, 0.5)
+		return mgl32.FloatEqualThreshold(mid.Dist(p.Point), mid.Dist(q.Point), 1e-3)
+	})
+	checkProperty(t, "Transform by the identity changes nothing", func(p quickPoint) bool {
+		return approxPoint(p.Transform(mgl32.Ident4()), p.Point)
+	})
+	checkProperty(t, "Transform by a translation moves only the position", func(p quickPoint, x, y, z int8) bool {
+		q := p.Transform(mgl32.Translate3D(float32(x), float32(y), float32(z)))
+		moved := p.P.Add(mgl32.Vec3{float32(x), float32(y), float32(z)})
+		return near(q.P[:], moved[:]) &&
+			approxPoint(q.SetP(p.X(), p.Y(), p.Z()), p.Point)
+	})
+	checkProperty(t, "MassOffset adds the position and keeps the rest", func(o, p, q quickPoint) bool {
+		off := o.MassOffset(p.Point, q.Point)
+		for i, pt := range []*Point{p.Point, q.Point} {
+			if off[i].P != pt.P.Add(o.P) || !sameAttribs(off[i], pt) {
+				return false
+			}
+		}
+		return len(off) == 2
+	})
+	checkProperty(t, "ReScale scales the position and keeps the rest", func(p quickPoint, x, y, z int8) bool {
+		q := p.ReScale(float32(x), float32(y), float32(z))
+		want := mgl32.Vec3{p.X() * float32(x), p.Y() * float32(y), p.Z() * float32(z)}
+		return q.P == want && sameAttribs(q, p.Point)
+	})
+	checkProperty(t, "PointsBounds contains every point", func(pts []quickPoint) bool {
+		raw := make([]*Point, len(pts))
+		for i, p := range pts {
+			raw[i] = p.Point
+		}
+		box := PointsBounds(raw...)
+		if len(pts) == 0 {
+			return box.Empty()
+		}
+		// Every face has to touch a point too, or the box is larger than it needs to be
+		var touchMin, touchMax [3]bool
+		for _, p := range raw {
+			for i := 0; i < 3; i++ {
+				if p.P[i] < box.Min[i] || p.P[i] > box.Max[i] {
+					return false
+				}
+				touchMin[i] = touchMin[i] || p.P[i] == box.Min[i]
+				touchMax[i] = touchMax[i] || p.P[i] == box.Max[i]
+			}
+		}
+		return touchMin == [3]bool{true, true, true} && touchMax == [3]bool{true, true, true}
+	})
+}
+
+func TestShapeReScaleKeepsAttribs(t *testing.T) {
+	checkProperty(t, "Shape.ReScale", func(p, q quickPoint, x, y, z int8) bool {
+		s := NewShape(mgl32.Ident4(), nil, p.Point, q.Point)
+		s.SetTypes(gl.LINES)
+		r := s.ReScale(float32(x), float32(y), float32(z))
+		if len(r.Pts) != 2 || r.Type != s.Type || r.Material != s.Material {
+			return false
+		}
+		for i := range r.Pts {
+			if !sameAttribs(r.Pts[i], s.Pts[i]) {
+				return false
+			}
+		}
+		return true
+	})
+}
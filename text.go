@@ -0,0 +1,295 @@
+package main
+
+import (
+	"container/list"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// Horizontal alignment of the lines of a text
+const (
+	ALIGN_LEFT = iota
+	ALIGN_CENTER
+	ALIGN_RIGHT
+)
+
+// Text is laid out in ems, 1 is the size the font was loaded at, with x going
+// right and y going up. Everything sits on the z = 1 plane, like the buttons
+type TextOptions struct {
+	// Lines longer than this are broken at spaces, or anywhere if there is
+	// no space to break at, 0 to only break at newlines
+	MaxWidth float32
+	Align    int
+	// Distance between baselines in multiples of the line height of the font, 0 means 1
+	LineSpacing float32
+}
+
+// A glyph placed by Layout
+type PlacedGlyph struct {
+	Rune  rune
+	Glyph *Glyph
+	// Where the pen is when the glyph is drawn, on its baseline
+	Pen mgl32.Vec2
+}
+
+type TextLayout struct {
+	Glyphs []PlacedGlyph
+	// Spans the advances of the lines, from the ascent of the first one to the
+	// descent of the last one, the top left corner is at 0, 0
+	Bounds AABB
+	Lines  int
+}
+
+// Size of an em in pixels at OgScale
+func (f *Font) em() float32 {
+	return float32(f.OgScale) / 64
+}
+
+func (f *Font) toEm(x fixed.Int26_6) float32 {
+	return float32(x) / 64 / f.em()
+}
+
+// Number of glyphs a font keeps in its atlas unless told otherwise
+const DefaultMaxGlyphs = 256
+
+// Used for all of the text of the client, the Go font unless
+// SNEK3D_FONT names a TTF or OTF file to use instead
+var DefaultFont *Font
+
+// Glyph is a rune rasterized into the atlas of its font, glyphs have no
+// buffers of their own, text shapes copy their quads into one buffer
+type Glyph struct {
+	Rune  rune
+	Index sfnt.GlyphIndex
+	// Two triangles showing the glyph with the pen at 0, 0, empty if there is nothing to draw
+	Quad []*Point
+	// How far the pen moves after the glyph, in ems
+	Advance float32
+	// Cell of the atlas holding it, -1 for none
+	cell int
+	// Place in the lru list of the font
+	elem *list.Element
+}
+
+// Returns the glyph of r, loading it the first time r is used
+// Runes the font doesn't have give the Missing glyph
+func (f *Font) Glyph(r rune) *Glyph {
+	if g, ok := f.glyphs[r]; ok {
+		f.lru.MoveToFront(g.elem)
+		return g
+	}
+	x, err := f.TtfFont.GlyphIndex(&sfnt.Buffer{}, r)
+	orDie(err)
+	if x == 0 {
+		return f.Missing
+	}
+	for len(f.glyphs) >= f.MaxGlyphs {
+		old := f.leastRecentlyUsed()
+		if old == nil {
+			// Every cached glyph is in the text being laid out
+			break
+		}
+		f.evict(old)
+	}
+	g, ok := f.loadGlyph(x)
+	g.Rune = r
+	if !ok {
+		// The atlas is full of glyphs of the text being laid out, this one is
+		// left blank there and not cached, so that it is loaded properly next time
+		return g
+	}
+	g.elem = f.lru.PushFront(g)
+	f.glyphs[r] = g
+	return g
+}
+
+// Returns the least recently used glyph which the Layout in progress
+// doesn't use, nil if there is none
+func (f *Font) leastRecentlyUsed() *Glyph {
+	for e := f.lru.Back(); e != nil; e = e.Prev() {
+		if g := e.Value.(*Glyph); !f.inUse[g.Rune] {
+			return g
+		}
+	}
+	return nil
+}
+
+// Drops g from the cache and gives its cell back to the atlas
+func (f *Font) evict(g *Glyph) {
+	if g.cell != -1 {
+		f.Atlas.Release(g.cell)
+	}
+	f.lru.Remove(g.elem)
+	delete(f.glyphs, g.Rune)
+	f.Evictions++
+}
+
+// Rasterizes glyph x into the atlas, the quad is empty if the glyph has no
+// outline or the atlas is full, ok is false only in the latter case
+func (f *Font) loadGlyph(x sfnt.GlyphIndex) (g *Glyph, ok bool) {
+	buf := &sfnt.Buffer{}
+	adv, err := f.TtfFont.GlyphAdvance(buf, x, f.OgScale, font.HintingNone)
+	orDie(err)
+	g = &Glyph{Index: x, Advance: f.toEm(adv), cell: -1}
+	segs, err := f.TtfFont.LoadGlyph(buf, x, f.OgScale, nil)
+	orDie(err)
+	// Space, escape codes and the like have nothing to fill in
+	b := segmentsBounds(segs)
+	if b.Empty() {
+		return g, true
+	}
+	cell, ok := f.Atlas.Alloc()
+	if !ok {
+		return g, false
+	}
+	g.cell = cell
+	// Control points can stick out of the font bounds a little, clip them to the cell
+	maxX, maxY := f.Atlas.CellW-2*atlasPadding, f.Atlas.CellH-2*atlasPadding
+	if b.Dx() > maxX {
+		b.Max.X = b.Min.X + maxX
+	}
+	if b.Dy() > maxY {
+		b.Max.Y = b.Min.Y + maxY
+	}
+	f.Atlas.Put(cell, rasterizeGlyph(segs, b))
+	// sfnt has y going down from the baseline
+	corner := func(px, py int) *Point {
+		u, v := f.Atlas.UV(cell, float32(px-b.Min.X), float32(py-b.Min.Y))
+		return P(float32(px)/f.em(), -float32(py)/f.em(), 1).SetT(u, v)
+	}
+	tl, tr := corner(b.Min.X, b.Min.Y), corner(b.Max.X, b.Min.Y)
+	bl, br := corner(b.Min.X, b.Max.Y), corner(b.Max.X, b.Max.Y)
+	g.Quad = []*Point{tl, bl, br, tl, br, tr}
+	return g, true
+}
+
+// Places the glyphs of s line by line, see TextOptions
+// Glyphs placed earlier are kept while the rest of s is laid out, so a text
+// with more than MaxGlyphs distinct runes shows the ones past what fits as blanks
+func (f *Font) Layout(s string, opts TextOptions) *TextLayout {
+	f.inUse = make(map[rune]bool)
+	defer func() { f.inUse = nil }()
+	buf := &sfnt.Buffer{}
+	metrics, err := f.TtfFont.Metrics(buf, f.OgScale, font.HintingNone)
+	orDie(err)
+	ascent, descent := f.toEm(metrics.Ascent), f.toEm(metrics.Descent)
+	spacing := opts.LineSpacing
+	if spacing == 0 {
+		spacing = 1
+	}
+	lineHeight := f.toEm(metrics.Height) * spacing
+
+	type line struct {
+		glyphs []PlacedGlyph
+		width  float32
+	}
+	var lines []line
+	cur := line{}
+	runes := []rune(s)
+	// Start of the current line in runes, and the last space in it to break at
+	start, space := 0, -1
+	var prev sfnt.GlyphIndex
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '\n' {
+			lines = append(lines, cur)
+			cur, start, space, prev = line{}, i+1, -1, 0
+			continue
+		}
+		g := f.Glyph(r)
+		f.inUse[r] = true
+		pen := cur.width
+		if i > start {
+			// Fonts without a kern table return an error, they just don't kern
+			if kern, err := f.TtfFont.Kern(buf, prev, g.Index, f.OgScale, font.HintingNone); err == nil {
+				pen += f.toEm(kern)
+			}
+		}
+		if opts.MaxWidth > 0 && r != ' ' && pen+g.Advance > opts.MaxWidth && i > start {
+			if space >= start {
+				// Take the word back and start it on the next line
+				cur.glyphs = cur.glyphs[:space-start]
+				i = space
+			} else {
+				// A single word wider than a line is broken where it doesn't fit
+				i--
+			}
+			lines = append(lines, cur)
+			cur, start, space, prev = line{}, i+1, -1, 0
+			continue
+		}
+		if r == ' ' {
+			space = i
+		}
+		cur.glyphs = append(cur.glyphs, PlacedGlyph{r, g, mgl32.Vec2{pen, 0}})
+		cur.width = pen + g.Advance
+		prev = g.Index
+	}
+	lines = append(lines, cur)
+
+	// Spaces at the end of a line don't count for alignment
+	width := float32(0)
+	for i := range lines {
+		lines[i].width = lineWidth(lines[i].glyphs)
+		if lines[i].width > width {
+			width = lines[i].width
+		}
+	}
+	if opts.MaxWidth > 0 {
+		width = opts.MaxWidth
+	}
+	t := &TextLayout{Lines: len(lines)}
+	for i, l := range lines {
+		shift := float32(0)
+		switch opts.Align {
+		case ALIGN_CENTER:
+			shift = (width - l.width) / 2
+		case ALIGN_RIGHT:
+			shift = width - l.width
+		}
+		baseline := -ascent - float32(i)*lineHeight
+		for _, g := range l.glyphs {
+			g.Pen = mgl32.Vec2{g.Pen.X() + shift, baseline}
+			t.Glyphs = append(t.Glyphs, g)
+		}
+	}
+	bottom := -ascent - float32(len(lines)-1)*lineHeight - descent
+	t.Bounds = NewAABB(mgl32.Vec3{0, bottom, 1}, mgl32.Vec3{width, 0, 1})
+	return t
+}
+
+// Width of the line up to the end of its last glyph which isn't a space
+func lineWidth(glyphs []PlacedGlyph) float32 {
+	for i := len(glyphs) - 1; i >= 0; i-- {
+		if glyphs[i].Rune != ' ' {
+			return glyphs[i].Pen.X() + glyphs[i].Glyph.Advance
+		}
+	}
+	return 0
+}
+
+// Returns a single shape drawing every glyph of the layout
+func (f *Font) LayoutToShape(t *TextLayout) *Shape {
+	text := NewShape(mgl32.Ident4(), f.Material)
+	for _, g := range t.Glyphs {
+		text.Pts = append(text.Pts, P(g.Pen.X(), g.Pen.Y(), 0).MassOffset(g.Glyph.Quad...)...)
+	}
+	// Every glyph is two triangles of its own
+	text.SetTypes(gl.TRIANGLES)
+	return text
+}
+
+// Lays out s on a single line, or more if it has newlines, left aligned
+func TextToShape(f *Font, s string) *Shape {
+	return f.LayoutToShape(f.Layout(s, TextOptions{}))
+}
+
+// Returns the shape of s laid out as opts say, along with the bounds of the layout
+func TextToShapeOpts(f *Font, s string, opts TextOptions) (*Shape, AABB) {
+	t := f.Layout(s, opts)
+	return f.LayoutToShape(t), t.Bounds
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// How long the server gets to send whatever it still has after being told we quit
+const drainTimeout = 500 * time.Millisecond
+
+var (
+	// Guards createdFifos, and inputFile and outputFile for the signal handler,
+	// the files are only ever changed on the main thread
+	transportMu sync.Mutex
+	// FIFOs made by the client, removed again by CloseTransport
+	createdFifos []string
+	// Set once a signal asks us to quit
+	quitting int32
+	// What OpenTransport was called with, to open the same FIFOs again in Reconnect
+	transportInput, transportOutput string
+	transportCreate                 bool
+)
+
+const (
+	// How often to look for a FIFO the server hasn't made yet, or at FIFOs being opened
+	fifoPollInterval = 100 * time.Millisecond
+	// How often to remind that we are still waiting for the server
+	waitReportInterval = 5 * time.Second
+)
+
+// Opens the FIFOs the server talks to us through, "-" means stdin for
+// the input and stdout for the output, see prepareFifo for force and create
+// Both ends are opened at the same time, so it doesn't matter which one the
+// server opens first, gives up after timeout unless it is 0
+func OpenTransport(inputName, outputName string, force, create bool, timeout time.Duration) error {
+	transportInput, transportOutput, transportCreate = inputName, outputName, create
+	in, out, err := openFifos(inputName, outputName, force, create, timeout)
+	if err != nil {
+		return err
+	}
+	setFiles(in, out)
+	return nil
+}
+
+// Does the work of OpenTransport without touching inputFile and outputFile,
+// so that it can run off the main thread
+func openFifos(inputName, outputName string, force, create bool, timeout time.Duration) (in, out *os.File, err error) {
+	in, out = os.Stdin, os.Stdout
+	// Waiting for the server to make the FIFOs counts towards the timeout too
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	// Both are made before opening either, so that failing to make one
+	// doesn't leave an open of the other to be cancelled
+	for _, name := range []string{inputName, outputName} {
+		if name == "-" {
+			continue
+		}
+		if err := prepareFifo(name, force, create, deadline); err != nil {
+			return nil, nil, err
+		}
+	}
+	var pending []*fifoOpen
+	if inputName != "-" {
+		pending = append(pending, startOpen(inputName, os.O_RDONLY))
+	}
+	if outputName != "-" {
+		pending = append(pending, startOpen(outputName, os.O_WRONLY))
+	}
+	opens := append([]*fifoOpen(nil), pending...)
+	var lastReport time.Time
+	for len(pending) > 0 {
+		waiting := pending[:0]
+		for _, o := range pending {
+			select {
+			case r := <-o.done:
+				o.finished = true
+				if r.err != nil {
+					cancelOpens(opens)
+					return nil, nil, r.err
+				}
+				o.file = r.f
+			default:
+				waiting = append(waiting, o)
+			}
+		}
+		pending = waiting
+		if len(pending) == 0 {
+			break
+		}
+		switch {
+		case !deadline.IsZero() && time.Now().After(deadline):
+			cancelOpens(opens)
+			return nil, nil, fmt.Errorf("timed out after %s waiting for the server to open %s", timeout, joinOpens(pending))
+		case Quitting():
+			cancelOpens(opens)
+			return nil, nil, fmt.Errorf("gave up waiting for the server to open %s", joinOpens(pending))
+		case time.Since(lastReport) >= waitReportInterval:
+			for _, o := range pending {
+				fmt.Fprintf(os.Stderr, "Waiting for the server to open %s\n", o)
+			}
+			lastReport = time.Now()
+		}
+		time.Sleep(fifoPollInterval)
+	}
+	for _, o := range opens {
+		if o.flag == os.O_RDONLY {
+			in = o.file
+		} else {
+			out = o.file
+		}
+	}
+	return in, out, nil
+}
+
+// Switches over to in and out, only call this on the main thread
+func setFiles(in, out *os.File) {
+	transportMu.Lock()
+	defer transportMu.Unlock()
+	inputFile, outputFile = in, out
+}
+
+type openResult struct {
+	f   *os.File
+	err error
+}
+
+// A FIFO being opened in the background, opening one end blocks until the other one is opened
+type fifoOpen struct {
+	name string
+	flag int
+	done chan openResult
+	// Set once the result was taken from done, whether it opened or not
+	finished bool
+	// Set once it is open
+	file *os.File
+}
+
+func startOpen(name string, flag int) *fifoOpen {
+	o := &fifoOpen{name: name, flag: flag, done: make(chan openResult, 1)}
+	go func() {
+		f, err := os.OpenFile(name, flag, os.ModeNamedPipe)
+		o.done <- openResult{f, err}
+	}()
+	return o
+}
+
+// Says which end the server has to open, for the messages while waiting on it
+func (o *fifoOpen) String() string {
+	if o.flag == os.O_RDONLY {
+		return o.name + " for writing, to send us frames"
+	}
+	return o.name + " for reading, to get our keys"
+}
+
+func joinOpens(opens []*fifoOpen) string {
+	names := make([]string, len(opens))
+	for i, o := range opens {
+		names[i] = o.String()
+	}
+	return strings.Join(names, " and ")
+}
+
+// Closes the ends which are already open, and unblocks the others by
+// opening their other end ourselves so that nothing is left hanging
+func cancelOpens(opens []*fifoOpen) {
+	for _, o := range opens {
+		other := os.O_WRONLY
+		if o.flag == os.O_WRONLY {
+			other = os.O_RDONLY
+		}
+		for !o.finished {
+			f, err := os.OpenFile(o.name, other|syscall.O_NONBLOCK, os.ModeNamedPipe)
+			if err == nil {
+				if r := <-o.done; r.f != nil {
+					o.file = r.f
+				}
+				o.finished = true
+				f.Close()
+				break
+			}
+			if !errors.Is(err, syscall.ENXIO) {
+				// Can't unblock it, the goroutine stays until we exit
+				break
+			}
+			// The goroutine hasn't opened its end for reading yet, so there is
+			// nobody to write to, try again unless it finished in the meantime
+			select {
+			case r := <-o.done:
+				o.file = r.f
+				o.finished = true
+			case <-time.After(fifoPollInterval / 10):
+			}
+		}
+		if o.file != nil {
+			o.file.Close()
+			o.file = nil
+		}
+	}
+}
+
+// Makes sure there is a FIFO at name, an existing one is used as is
+// Anything else at name is only replaced if force is set, so that a typo
+// doesn't delete a file, and if create isn't set we wait for the server to
+// make the FIFO instead of making it ourselves, until deadline unless it is zero
+func prepareFifo(name string, force, create bool, deadline time.Time) error {
+	info, err := os.Stat(name)
+	switch {
+	case err == nil && info.Mode()&os.ModeNamedPipe != 0:
+		// Whoever made it removes it
+		return nil
+	case err == nil && !force:
+		return fmt.Errorf("%s exists and is not a FIFO, pass -force to replace it", name)
+	case err == nil && info.IsDir():
+		return fmt.Errorf("%s is a directory, not replacing it even with -force", name)
+	case err == nil:
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+	if !create {
+		fmt.Fprintf(os.Stderr, "Waiting for the server to create %s\n", name)
+		for {
+			if _, err := os.Stat(name); err == nil {
+				return prepareFifo(name, force, create, deadline)
+			}
+			if Quitting() {
+				return fmt.Errorf("gave up waiting for %s", name)
+			}
+			if !deadline.IsZero() && time.Now().After(deadline) {
+				return fmt.Errorf("timed out waiting for the server to create %s", name)
+			}
+			time.Sleep(fifoPollInterval)
+		}
+	}
+	if err := unix.Mkfifo(name, 0666); err != nil {
+		return err
+	}
+	// Reconnect makes them off the main thread
+	transportMu.Lock()
+	createdFifos = append(createdFifos, name)
+	transportMu.Unlock()
+	return nil
+}
+
+// Tells the server we are leaving and reads what it still sends, until it
+// closes its end or drainTimeout passes
+func Disconnect() {
+	outputFile.Write([]byte{CMD_QUIT})
+	// Terminals and files can't time out, there is nothing to drain from them anyway
+	if inputFile.SetReadDeadline(time.Now().Add(drainTimeout)) == nil {
+		io.Copy(ioutil.Discard, inputFile)
+	}
+}
+
+// Reports whether the server can be connected to again once it goes away,
+// stdin and stdout can't be opened again
+func CanReconnect() bool {
+	return transportInput != "-" && transportOutput != "-"
+}
+
+// The ends of the FIFOs opened again by Reconnect
+type Reopened struct {
+	In, Out *os.File
+	Err     error
+}
+
+// Closes both ends and opens the same FIFOs again in the background, for
+// after the server restarted, the result is sent on the returned channel
+// Nothing is read or written until it is passed to Use on the main thread
+func Reconnect(timeout time.Duration) <-chan Reopened {
+	closeFiles()
+	done := make(chan Reopened, 1)
+	go func() {
+		// Anything in the way was already replaced or refused the first time
+		in, out, err := openFifos(transportInput, transportOutput, false, transportCreate, timeout)
+		done <- Reopened{in, out, err}
+	}()
+	return done
+}
+
+// Switches over to the reopened FIFOs, returns why they couldn't be opened instead if they weren't
+// Handshake has to be done again after this
+func (r Reopened) Use() error {
+	if r.Err != nil {
+		return r.Err
+	}
+	setFiles(r.In, r.Out)
+	return nil
+}
+
+// Closes both ends, only call this on the main thread
+func closeFiles() {
+	transportMu.Lock()
+	defer transportMu.Unlock()
+	if inputFile != nil && inputFile != os.Stdin {
+		inputFile.Close()
+	}
+	if outputFile != nil && outputFile != os.Stdout {
+		outputFile.Close()
+	}
+	inputFile, outputFile = nil, nil
+}
+
+// Closes both ends and removes the FIFOs the client made, safe to call more than once
+func CloseTransport() {
+	closeFiles()
+	transportMu.Lock()
+	defer transportMu.Unlock()
+	for _, name := range createdFifos {
+		os.Remove(name)
+	}
+	createdFifos = nil
+}
+
+// Makes the first SIGINT or SIGTERM shut down like closing the window does,
+// a second one removes the FIFOs and exits right away, for when that gets stuck
+func HandleSignals() {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		atomic.StoreInt32(&quitting, 1)
+		os.Stderr.WriteString("Shutting down, send it again to exit right away\n")
+		// Reads waiting on the server give up, so that the main loop gets to see it
+		transportMu.Lock()
+		if inputFile != nil {
+			inputFile.SetReadDeadline(time.Now())
+		}
+		transportMu.Unlock()
+		<-sigs
+		transportMu.Lock()
+		for _, name := range createdFifos {
+			os.Remove(name)
+		}
+		os.Exit(1)
+	}()
+}
+
+// Reports whether a signal asked us to quit
+func Quitting() bool {
+	return atomic.LoadInt32(&quitting) == 1
+}
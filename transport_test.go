@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestPrepareFifoDeadline(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "in")
+	start := time.Now()
+	err := prepareFifo(name, false, false, start.Add(3*fifoPollInterval))
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("prepareFifo without a server = %v, want a timeout", err)
+	}
+	if waited := time.Since(start); waited > time.Second {
+		t.Errorf("gave up after %s", waited)
+	}
+
+	// The server making it in time is fine
+	go func() {
+		time.Sleep(fifoPollInterval)
+		os.WriteFile(name, nil, 0666)
+	}()
+	err = prepareFifo(name, false, false, time.Now().Add(10*fifoPollInterval))
+	if err == nil || !strings.Contains(err.Error(), "not a FIFO") {
+		t.Errorf("prepareFifo after a regular file appeared = %v, want it refused", err)
+	}
+}
+
+func TestCancelOpensAfterFailure(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "out")
+	if err := unix.Mkfifo(name, 0666); err != nil {
+		t.Fatal(err)
+	}
+	// Opening it for writing failed and the result was taken already, but the
+	// read end it would open to unblock it can be opened
+	failed := &fifoOpen{name: name, flag: os.O_WRONLY, done: make(chan openResult, 1), finished: true}
+	done := make(chan struct{})
+	go func() {
+		cancelOpens([]*fifoOpen{failed})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("cancelOpens is stuck waiting on the open which already failed")
+	}
+}
+
+func TestCancelOpensRightAway(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "in")
+	if err := unix.Mkfifo(name, 0666); err != nil {
+		t.Fatal(err)
+	}
+	// The goroutine most likely hasn't reached open(2) yet, so there is no
+	// reader and opening the write end to unblock it fails at first
+	o := startOpen(name, os.O_RDONLY)
+	done := make(chan struct{})
+	go func() {
+		cancelOpens([]*fifoOpen{o})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("cancelOpens never unblocked the open")
+	}
+	if !o.finished || o.file != nil {
+		t.Errorf("open left finished = %v with file %v", o.finished, o.file)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	dir := t.TempDir()
+	transportInput, transportOutput = filepath.Join(dir, "in"), filepath.Join(dir, "out")
+	transportCreate = true
+	defer CloseTransport()
+	done := Reconnect(2 * time.Second)
+	// The server comes back once the client has made the FIFOs
+	server := make(chan [2]*os.File, 1)
+	go func() {
+		for {
+			_, errIn := os.Stat(transportInput)
+			_, errOut := os.Stat(transportOutput)
+			if errIn == nil && errOut == nil {
+				break
+			}
+			time.Sleep(fifoPollInterval / 10)
+		}
+		w, _ := os.OpenFile(transportInput, os.O_WRONLY, os.ModeNamedPipe)
+		r, _ := os.OpenFile(transportOutput, os.O_RDONLY, os.ModeNamedPipe)
+		server <- [2]*os.File{w, r}
+	}()
+	var r Reopened
+	select {
+	case r = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reconnect never finished")
+	}
+	if inputFile != nil || outputFile != nil {
+		t.Error("Reconnect switched the files over before Use")
+	}
+	if err := r.Use(); err != nil {
+		t.Fatal(err)
+	}
+	ends := <-server
+	defer ends[0].Close()
+	defer ends[1].Close()
+	ends[0].Write([]byte{42})
+	got := make([]byte, 1)
+	if _, err := inputFile.Read(got); err != nil || got[0] != 42 {
+		t.Errorf("read %v, %v from the reopened input", got, err)
+	}
+	CloseTransport()
+	for _, name := range []string{transportInput, transportOutput} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s was made by the client but not removed: %v", name, err)
+		}
+	}
+}
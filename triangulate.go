@@ -0,0 +1,253 @@
+package main
+
+import (
+	"math"
+	"sort"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Twice the signed area of the ring on the XY plane, positive if it goes counter clockwise
+func signedArea(ring []*Point) float32 {
+	area := float32(0)
+	for i, p := range ring {
+		q := ring[(i+1)%len(ring)]
+		area += p.X()*q.Y() - q.X()*p.Y()
+	}
+	return area
+}
+
+// Returns the ring going the other way around if it doesn't already go counter clockwise
+func windCCW(ring []*Point, ccw bool) []*Point {
+	if (signedArea(ring) > 0) == ccw {
+		return ring
+	}
+	rev := make([]*Point, len(ring))
+	for i, p := range ring {
+		rev[len(ring)-1-i] = p
+	}
+	return rev
+}
+
+// Cross product of b-a and c-a on the XY plane, positive if a, b, c turn left
+func cross2(a, b, c *Point) float32 {
+	return (b.X()-a.X())*(c.Y()-a.Y()) - (b.Y()-a.Y())*(c.X()-a.X())
+}
+
+// Reports whether p is inside or on the edges of the counter clockwise triangle a, b, c
+func inTriangle(p, a, b, c *Point) bool {
+	return cross2(a, b, p) >= 0 && cross2(b, c, p) >= 0 && cross2(c, a, p) >= 0
+}
+
+func samePos(p, q *Point) bool {
+	return p.X() == q.X() && p.Y() == q.Y()
+}
+
+// Ear clipping triangulation of a simple polygon with holes on the XY plane
+// The outline and the holes can go either way around and must not touch each
+// other, the returned points are the triangles one after another, counter
+// clockwise, to be drawn as TRIANGLES
+func TriangulatePolygon(outline []*Point, holes ...[]*Point) []*Point {
+	if len(outline) < 3 {
+		return nil
+	}
+	ring := windCCW(dropClosingPoint(outline), true)
+	// Holes are cut in one by one from the rightmost one, so that every bridge
+	// only has to avoid the holes which are already a part of the ring
+	var hs [][]*Point
+	for _, h := range holes {
+		if h = dropClosingPoint(h); len(h) >= 3 {
+			hs = append(hs, windCCW(h, false))
+		}
+	}
+	sort.Slice(hs, func(i, j int) bool {
+		return hs[i][rightmost(hs[i])].X() > hs[j][rightmost(hs[j])].X()
+	})
+	for _, h := range hs {
+		ring = bridgeHole(ring, h)
+	}
+	return clipEars(ring)
+}
+
+// Outlines often repeat the first point at the end, it would make a zero length edge
+func dropClosingPoint(ring []*Point) []*Point {
+	if len(ring) > 1 && samePos(ring[0], ring[len(ring)-1]) {
+		return ring[:len(ring)-1]
+	}
+	return ring
+}
+
+func rightmost(ring []*Point) int {
+	r := 0
+	for i, p := range ring {
+		if p.X() > ring[r].X() {
+			r = i
+		}
+	}
+	return r
+}
+
+// Joins the clockwise hole into the counter clockwise ring through two
+// overlapping edges between a point of each, which can see each other
+func bridgeHole(ring, hole []*Point) []*Point {
+	hi := rightmost(hole)
+	m := hole[hi]
+	// Find the nearest edge to the right of m, going straight along x
+	bestX := float32(math.Inf(1))
+	ri := -1
+	// Set if the ray hits the edge right on one of its ends
+	onVertex := false
+	for i, a := range ring {
+		b := ring[(i+1)%len(ring)]
+		// Edges on the right of a counter clockwise ring go up
+		if !(a.Y() <= m.Y() && b.Y() >= m.Y()) || a.Y() == b.Y() {
+			continue
+		}
+		x := a.X() + (m.Y()-a.Y())*(b.X()-a.X())/(b.Y()-a.Y())
+		if x >= m.X() && x < bestX {
+			bestX = x
+			switch {
+			case a.Y() == m.Y():
+				ri, onVertex = i, true
+			case b.Y() == m.Y():
+				ri, onVertex = (i+1)%len(ring), true
+			case a.X() > b.X():
+				// The end of the edge further to the right is a candidate to bridge to
+				ri, onVertex = i, false
+			default:
+				ri, onVertex = (i+1)%len(ring), false
+			}
+		}
+	}
+	if ri == -1 {
+		// The hole is not inside the ring, leave it out
+		return ring
+	}
+	if !onVertex {
+		// Points of the ring inside the triangle between m, where the ray hit and
+		// the candidate block the view, the one at the smallest angle from the ray
+		// can be seen, points on the ray or on the hit edge don't block anything
+		hit := P(bestX, m.Y(), m.Z())
+		cand := ring[ri]
+		a, b, c := m, hit, cand
+		if cross2(a, b, c) < 0 {
+			b, c = c, b
+		}
+		bestAngle, bestDist := float32(math.Inf(1)), float32(math.Inf(1))
+		for i, p := range ring {
+			if samePos(p, cand) || !inTriangle(p, a, b, c) || cross2(m, hit, p) == 0 || cross2(hit, cand, p) == 0 {
+				continue
+			}
+			d := p.P.Sub(m.P)
+			angle := float32(math.Abs(math.Atan2(float64(d.Y()), float64(d.X()))))
+			if angle < bestAngle || (angle == bestAngle && d.Len() < bestDist) {
+				bestAngle, bestDist = angle, d.Len()
+				ri = i
+			}
+		}
+	}
+	ri = visibleCopy(ring, ri, m)
+	// ring up to r, the hole starting and ending at m, then back to r and on
+	joined := make([]*Point, 0, len(ring)+len(hole)+2)
+	joined = append(joined, ring[:ri+1]...)
+	for i := 0; i <= len(hole); i++ {
+		joined = append(joined, hole[(hi+i)%len(hole)])
+	}
+	joined = append(joined, ring[ri:]...)
+	return joined
+}
+
+// Points bridged to before are in the ring twice, returns the copy of ring[ri]
+// whose corner opens towards m, bridging from the other one would cross the ring
+func visibleCopy(ring []*Point, ri int, m *Point) int {
+	for j, p := range ring {
+		if !samePos(p, ring[ri]) {
+			continue
+		}
+		prev, next := ring[(j+len(ring)-1)%len(ring)], ring[(j+1)%len(ring)]
+		if cross2(prev, p, next) >= 0 {
+			// Convex corner, m has to be left of both edges
+			if cross2(prev, p, m) > 0 && cross2(p, next, m) > 0 {
+				return j
+			}
+		} else if cross2(prev, p, m) > 0 || cross2(p, next, m) > 0 {
+			// Reflex corner, m only has to be left of one of them
+			return j
+		}
+	}
+	return ri
+}
+
+// Cuts off ears of the counter clockwise ring until only one triangle is left
+func clipEars(ring []*Point) []*Point {
+	idx := make([]int, len(ring))
+	for i := range idx {
+		idx[i] = i
+	}
+	var tris []*Point
+	for len(idx) > 3 {
+		clipped := false
+		for i := range idx {
+			prev, cur, next := idx[(i+len(idx)-1)%len(idx)], idx[i], idx[(i+1)%len(idx)]
+			if !isEar(ring, idx, prev, cur, next) {
+				continue
+			}
+			if cross2(ring[prev], ring[cur], ring[next]) != 0 {
+				tris = append(tris, ring[prev], ring[cur], ring[next])
+			}
+			idx = append(idx[:i], idx[i+1:]...)
+			clipped = true
+			break
+		}
+		if !clipped {
+			// Only happens with self intersecting or degenerate input,
+			// cut off a vertex anyway so that we finish
+			tris = append(tris, ring[idx[len(idx)-1]], ring[idx[0]], ring[idx[1]])
+			idx = idx[1:]
+		}
+	}
+	if len(idx) == 3 && cross2(ring[idx[0]], ring[idx[1]], ring[idx[2]]) != 0 {
+		tris = append(tris, ring[idx[0]], ring[idx[1]], ring[idx[2]])
+	}
+	return tris
+}
+
+// An ear is a convex corner whose triangle has no other point of the ring in it
+func isEar(ring []*Point, idx []int, prev, cur, next int) bool {
+	a, b, c := ring[prev], ring[cur], ring[next]
+	turn := cross2(a, b, c)
+	if turn < 0 {
+		return false
+	}
+	if turn == 0 {
+		// Straight corners make empty triangles, removing them is always fine
+		return true
+	}
+	for k, j := range idx {
+		p := ring[j]
+		if j == prev || j == cur || j == next {
+			continue
+		}
+		// The points doubled by bridging sit on the corners, they don't block
+		if samePos(p, a) || samePos(p, b) || samePos(p, c) {
+			continue
+		}
+		// Nothing can get into the triangle without a reflex or straight corner
+		// in it, convex ones only touch it where bridges overlap the edges
+		if cross2(ring[idx[(k+len(idx)-1)%len(idx)]], p, ring[idx[(k+1)%len(idx)]]) > 0 {
+			continue
+		}
+		if inTriangle(p, a, b, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns a shape filling the polygon, see TriangulatePolygon
+func NewPolygon(mat mgl32.Mat4, material *Material, outline []*Point, holes ...[]*Point) *Shape {
+	s := NewShape(mat, material, TriangulatePolygon(outline, holes...)...)
+	s.SetTypes(gl.TRIANGLES)
+	return s
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Ring through the given x, y pairs
+func ring(xy ...float32) []*Point {
+	pts := make([]*Point, len(xy)/2)
+	for i := range pts {
+		pts[i] = P(xy[2*i], xy[2*i+1], 0)
+	}
+	return pts
+}
+
+// Axis aligned square ring from x1, y1 to x2, y2, counter clockwise
+func rect(x1, y1, x2, y2 float32) []*Point {
+	return ring(x1, y1, x2, y1, x2, y2, x1, y2)
+}
+
+func reversed(r []*Point) []*Point {
+	rev := make([]*Point, len(r))
+	for i, p := range r {
+		rev[len(r)-1-i] = p
+	}
+	return rev
+}
+
+func TestTriangulatePolygon(t *testing.T) {
+	cases := []struct {
+		name    string
+		outline []*Point
+		holes   [][]*Point
+		area    float32
+	}{
+		{"triangle", ring(0, 0, 4, 0, 0, 3), nil, 6},
+		{"convex", ring(0, 0, 4, 0, 5, 2, 4, 4, 0, 4, -1, 2), nil, 20},
+		{"clockwise", reversed(rect(0, 0, 2, 3)), nil, 6},
+		{"closing point repeated", append(rect(0, 0, 2, 2), P(0, 0, 0)), nil, 4},
+		{"concave L", ring(0, 0, 4, 0, 4, 1, 1, 1, 1, 4, 0, 4), nil, 7},
+		{"concave comb", ring(0, 0, 5, 0, 5, 3, 4, 3, 4, 1, 3, 1, 3, 3, 2, 3, 2, 1, 1, 1, 1, 3, 0, 3), nil, 15 - 2 - 2},
+		{"collinear points", ring(0, 0, 1, 0, 2, 0, 2, 2, 0, 2), nil, 4},
+		{"one hole", rect(0, 0, 4, 4), [][]*Point{rect(1, 1, 3, 3)}, 12},
+		{"one clockwise hole", rect(0, 0, 4, 4), [][]*Point{reversed(rect(1, 1, 3, 3))}, 12},
+		// The ray from the right of the hole hits the outline right on a vertex
+		{"hole ray hits an outline vertex", ring(0, 0, 6, 0, 6, 2, 8, 3, 6, 4, 6, 6, 0, 6),
+			[][]*Point{rect(1, 1, 3, 3)}, 36 + 2 - 4},
+		// The ray from the second hole hits the first one where it was bridged
+		{"two holes hitting a vertex", rect(0, 0, 10, 4),
+			[][]*Point{rect(1, 1, 3, 3), rect(5, 1, 7, 3)}, 40 - 4 - 4},
+		{"two holes side by side", rect(0, 0, 10, 4),
+			[][]*Point{rect(1, 1, 3, 2), rect(5, 2, 7, 3)}, 40 - 2 - 2},
+		{"three holes in a row", rect(0, 0, 14, 4),
+			[][]*Point{rect(1, 1, 3, 3), rect(5, 1, 7, 3), rect(9, 1, 11, 3)}, 56 - 12},
+		{"hole in a concave outline", ring(0, 0, 6, 0, 6, 6, 4, 6, 4, 2, 2, 2, 2, 6, 0, 6),
+			[][]*Point{rect(0.5, 0.5, 5.5, 1.5)}, 28 - 5},
+	}
+	for _, c := range cases {
+		tris := TriangulatePolygon(c.outline, c.holes...)
+		if len(tris)%3 != 0 {
+			t.Errorf("%s: %d points is not a whole number of triangles", c.name, len(tris))
+			continue
+		}
+		area := float32(0)
+		for i := 0; i < len(tris); i += 3 {
+			turn := cross2(tris[i], tris[i+1], tris[i+2])
+			if turn <= 0 {
+				t.Errorf("%s: triangle %v %v %v is not counter clockwise", c.name,
+					tris[i].P, tris[i+1].P, tris[i+2].P)
+			}
+			area += turn / 2
+		}
+		if math.Abs(float64(area-c.area)) > 1e-4 {
+			t.Errorf("%s: triangles cover %v, want %v", c.name, area, c.area)
+		}
+		// Every triangle is inside the polygon, checked at its centroid
+		for i := 0; i < len(tris); i += 3 {
+			centroid := tris[i].P.Add(tris[i+1].P).Add(tris[i+2].P).Mul(1.0 / 3)
+			if !PtInPolygon(P(centroid.X(), centroid.Y(), 0), append([][]*Point{c.outline}, c.holes...)...) {
+				t.Errorf("%s: triangle %d is outside the polygon", c.name, i/3)
+			}
+		}
+	}
+}
+
+func TestTriangulateDegenerate(t *testing.T) {
+	if tris := TriangulatePolygon(ring(0, 0, 1, 1)); len(tris) != 0 {
+		t.Errorf("two points gave %d triangle points", len(tris))
+	}
+	if tris := TriangulatePolygon(ring(0, 0, 1, 1, 2, 2)); len(tris) != 0 {
+		t.Errorf("a straight line gave %d triangle points", len(tris))
+	}
+	// A hole outside of the outline is left out
+	tris := TriangulatePolygon(rect(0, 0, 1, 1), rect(5, 5, 6, 6))
+	if len(tris) != 6 {
+		t.Errorf("square with a hole outside it gave %d triangle points, want 6", len(tris))
+	}
+}
+
+func TestNewPolygon(t *testing.T) {
+	s := NewPolygon(mgl32.Ident4(), nil, rect(0, 0, 4, 4), rect(1, 1, 3, 3))
+	if s.Type != gl.TRIANGLES || int(s.Primitives) != len(s.Pts) || len(s.Pts) == 0 {
+		t.Errorf("NewPolygon made %d points of type 0x%X with %d primitives", len(s.Pts), s.Type, s.Primitives)
+	}
+}
+
+func TestPtInPolygon(t *testing.T) {
+	outline, hole := rect(0, 0, 4, 4), rect(1, 1, 3, 3)
+	concave := ring(0, 0, 4, 0, 4, 1, 1, 1, 1, 4, 0, 4)
+	cases := []struct {
+		name  string
+		x, y  float32
+		rings [][]*Point
+		in    bool
+	}{
+		{"inside", 2, 2, [][]*Point{outline}, true},
+		{"outside", 5, 2, [][]*Point{outline}, false},
+		{"left of it", -1, 2, [][]*Point{outline}, false},
+		{"above it", 2, 5, [][]*Point{outline}, false},
+		{"clockwise", 2, 2, [][]*Point{reversed(outline)}, true},
+		{"in the hole", 2, 2, [][]*Point{outline, hole}, false},
+		{"around the hole", 0.5, 2, [][]*Point{outline, hole}, true},
+		{"right of the hole", 3.5, 2, [][]*Point{outline, hole}, true},
+		{"in the arm of an L", 0.5, 3, [][]*Point{concave}, true},
+		{"in the notch of an L", 3, 3, [][]*Point{concave}, false},
+	}
+	for _, c := range cases {
+		if got := PtInPolygon(P(c.x, c.y, 0), c.rings...); got != c.in {
+			t.Errorf("%s: PtInPolygon(%v, %v) = %v, want %v", c.name, c.x, c.y, got, c.in)
+		}
+	}
+}
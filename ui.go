@@ -0,0 +1,115 @@
+package main
+
+import (
+	"github.com/go-gl/glfw/v3.3/glfw"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// The buttons which currently get the mouse, nil while nothing is on the screen
+var ActiveUI *UI
+
+// UI is a layer of buttons drawn over everything else with NewOverlayCamera
+type UI struct {
+	Scene   *Scene
+	Buttons []*Button
+	// The button the mouse went down on, it is only clicked if the mouse goes up on it too
+	pressed *Button
+}
+
+// cam is usually an overlay camera shared by every UI, so that it only has to be resized once
+func NewUI(cam *Camera) *UI {
+	return &UI{Scene: NewScene(cam)}
+}
+
+// Adds the buttons to the UI and generates their Vaos
+func (u *UI) Add(btns ...*Button) {
+	for _, b := range btns {
+		b.GenVao()
+		u.Buttons = append(u.Buttons, b)
+		u.Scene.Root.Add(NewNode(mgl32.Ident4(), b))
+	}
+	u.Scene.Invalidate()
+}
+
+// Converts the cursor position in window coords to screen space
+func (u *UI) toScreen(w *glfw.Window, x, y float64) *Point {
+	width, height := w.GetSize()
+	cam := u.Scene.Camera
+	return P(
+		(2*float32(x)/float32(width)-1)*cam.Height*cam.Aspect,
+		(1-2*float32(y)/float32(height))*cam.Height,
+		1)
+}
+
+// Returns the button under pt, nil if there is none
+func (u *UI) ButtonAt(pt *Point) *Button {
+	// Later buttons are drawn over earlier ones
+	for i := len(u.Buttons) - 1; i >= 0; i-- {
+		if b := u.Buttons[i]; !b.Disabled && b.Contains(pt) {
+			return b
+		}
+	}
+	return nil
+}
+
+// Highlights the button under the cursor, use it as the CursorPosCallback
+func (u *UI) HandleCursor(w *glfw.Window, x, y float64) {
+	hovered := u.ButtonAt(u.toScreen(w, x, y))
+	for _, b := range u.Buttons {
+		b.setState(b == hovered, b == hovered && b == u.pressed)
+	}
+}
+
+// Presses and clicks buttons with the left mouse button, returns whether
+// the event was on a button, if it isn't it can be handled by something else
+func (u *UI) HandleMouseButton(w *glfw.Window, button glfw.MouseButton, action glfw.Action, mods glfw.ModifierKey) bool {
+	if button != glfw.MouseButtonLeft {
+		return false
+	}
+	x, y := w.GetCursorPos()
+	hit := u.ButtonAt(u.toScreen(w, x, y))
+	handled := hit != nil
+	switch action {
+	case glfw.Press:
+		u.pressed = hit
+		if hit != nil {
+			hit.setState(true, true)
+		}
+	case glfw.Release:
+		pressed := u.pressed
+		u.pressed = nil
+		if pressed != nil {
+			pressed.setState(pressed == hit, false)
+			// Letting go of a button anywhere is a part of pressing it
+			handled = true
+		}
+		if hit != nil && hit == pressed && hit.CB != nil {
+			hit.CB(hit)
+		}
+	}
+	return handled
+}
+
+func (u *UI) Draw() {
+	// Laying out one button can drop the glyphs of another, go around until none
+	// of them changes, or give up once every button had a turn if they don't fit together
+	for i := 0; i <= len(u.Buttons); i++ {
+		changed := false
+		for _, b := range u.Buttons {
+			if b.refreshText() {
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+		u.Scene.Invalidate()
+	}
+	u.Scene.Draw()
+}
+
+func (u *UI) Free() {
+	for _, b := range u.Buttons {
+		b.Free()
+	}
+}
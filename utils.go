@@ -6,14 +6,14 @@ import (
 	"github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/go-gl/glfw/v3.3/glfw"
 	"github.com/go-gl/mathgl/mgl32"
-	"golang.org/x/image/font"
-	"golang.org/x/image/font/sfnt"
 	"golang.org/x/image/math/fixed"
 	"io/ioutil"
 	"math"
+	"regexp"
 	"strconv"
 	//	"github.com/go-gl/mathgl/mgl32"
 	"strings"
+	"unsafe"
 )
 
 func compileShader(source string, shaderType uint32) (uint32, error) {
@@ -33,21 +33,35 @@ func compileShader(source string, shaderType uint32) (uint32, error) {
 		log := strings.Repeat("\x00", int(logLength+1))
 		gl.GetShaderInfoLog(shader, logLength, nil, gl.Str(log))
 
-		return 0, fmt.Errorf("failed to compile %v: %v", source, log)
+		gl.DeleteShader(shader)
+		return 0, fmt.Errorf("failed to compile shader:\n%v", annotateShaderLog(source, log))
 	}
 
 	return shader, nil
 }
 
-func newProg(vertShad, fragShad string) (uint32, error) {
+// Compiles and links the shaders, the inputs of the vertex shader are bound
+// to the locations of the attributes with the same name in layout
+func newProg(vertShad, fragShad string, layout VertexLayout) (uint32, error) {
 	vertexShader, err := compileShader(vertShad, gl.VERTEX_SHADER)
-	orDie(err)
+	if err != nil {
+		return 0, fmt.Errorf("vertex %v", err)
+	}
 	fragmentShader, err := compileShader(fragShad, gl.FRAGMENT_SHADER)
-	orDie(err)
+	if err != nil {
+		gl.DeleteShader(vertexShader)
+		return 0, fmt.Errorf("fragment %v", err)
+	}
 	prog := gl.CreateProgram()
 	gl.AttachShader(prog, vertexShader)
 	gl.AttachShader(prog, fragmentShader)
+	for i, a := range layout {
+		gl.BindAttribLocation(prog, uint32(i), gl.Str(a.Name+"\x00"))
+	}
 	gl.LinkProgram(prog)
+	// The program keeps the shaders alive as long as it needs them
+	gl.DeleteShader(vertexShader)
+	gl.DeleteShader(fragmentShader)
 	var status int32
 	gl.GetProgramiv(prog, gl.LINK_STATUS, &status)
 	if status == gl.FALSE {
@@ -56,83 +70,119 @@ func newProg(vertShad, fragShad string) (uint32, error) {
 
 		log := strings.Repeat("\x00", int(logLength+1))
 		gl.GetProgramInfoLog(prog, logLength, nil, gl.Str(log))
+		gl.DeleteProgram(prog)
 
 		return 0, fmt.Errorf("failed to link prog: %v", log)
 	}
 
-	gl.DeleteShader(vertexShader)
-	gl.DeleteShader(fragmentShader)
+	if err := checkAttribs(prog, layout); err != nil {
+		gl.DeleteProgram(prog)
+		return 0, err
+	}
+	GLResources.TrackProgram(prog)
 
 	return prog, nil
 }
 
-func UpdateUniformMat4fv(name string, prog uint32, value *float32) {
-	UniformLocation := gl.GetUniformLocation(prog, gl.Str(name+"\x00"))
-	gl.UniformMatrix4fv(UniformLocation, 1, false, value)
+// Matches the line number in GLSL errors, Mesa reports them as 0:12(5)
+// and Nvidia as 0(12), the first number being the source string
+var shaderLogLine = regexp.MustCompile(`^\D*\d+[:(](\d+)`)
+
+// Adds the offending line of source below every line of the log which points at one
+func annotateShaderLog(source, log string) string {
+	srcLines := strings.Split(source, "\n")
+	var b strings.Builder
+	for _, l := range strings.Split(strings.TrimRight(log, "\x00\n"), "\n") {
+		b.WriteString(l)
+		b.WriteByte('\n')
+		m := shaderLogLine.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n < 1 || n > len(srcLines) {
+			continue
+		}
+		fmt.Fprintf(&b, "\t%4d | %s\n", n, strings.TrimRight(srcLines[n-1], "\x00"))
+	}
+	return b.String()
+}
 
+// Makes sure that every active input of the linked program is in layout,
+// at the same location and with the same number of floats
+// Inputs in layout but not in the program are fine, the linker drops unused ones
+func checkAttribs(prog uint32, layout VertexLayout) error {
+	glTypes := map[uint32]int32{
+		gl.FLOAT:      1,
+		gl.FLOAT_VEC2: 2,
+		gl.FLOAT_VEC3: 3,
+		gl.FLOAT_VEC4: 4,
+	}
+	var count, maxLen int32
+	gl.GetProgramiv(prog, gl.ACTIVE_ATTRIBUTES, &count)
+	gl.GetProgramiv(prog, gl.ACTIVE_ATTRIBUTE_MAX_LENGTH, &maxLen)
+	for i := int32(0); i < count; i++ {
+		var length, size int32
+		var glType uint32
+		nameBuf := make([]byte, maxLen+1)
+		gl.GetActiveAttrib(prog, uint32(i), maxLen+1, &length, &size, &glType, &nameBuf[0])
+		name := string(nameBuf[:length])
+		// Builtins like gl_VertexID are not fed from buffers
+		if strings.HasPrefix(name, "gl_") {
+			continue
+		}
+		index := -1
+		for j, a := range layout {
+			if a.Name == name {
+				index = j
+			}
+		}
+		if index == -1 {
+			return fmt.Errorf("shader input %s is not in the vertex layout", name)
+		}
+		if glTypes[glType] != layout[index].Size {
+			return fmt.Errorf("shader input %s has type 0x%X, vertex layout has %d floats", name, glType, layout[index].Size)
+		}
+		location := gl.GetAttribLocation(prog, gl.Str(name+"\x00"))
+		if location != int32(index) {
+			return fmt.Errorf("shader input %s is at location %d, vertex layout has it at %d", name, location, index)
+		}
+	}
+	return nil
 }
 
-func Refresh(w *glfw.Window) {
+// Fits the viewport and the camera to the framebuffer of w
+func Refresh(w *glfw.Window, cam *Camera) {
 	width, height := w.GetFramebufferSize()
 	gl.Viewport(0, 0, int32(width), int32(height))
-	projMat = mgl32.Perspective(mgl32.DegToRad(120), float32(width)/float32(height), 0.001, 200)
-	UpdateUniformMat4fv("projection", program, &projMat[0])
-	resVec := mgl32.Vec2{float32(width), float32(height)}
-	UniformLocation := gl.GetUniformLocation(program, gl.Str("u_resolution"+"\x00"))
-	gl.UniformMatrix4fv(UniformLocation, 1, false, &resVec[0])
-	fmt.Println(float32(width) / float32(height))
+	cam.Resize(width, height)
 }
 
 // This Algorithm was taken from http://www.jeffreythompson.org/collision-detection/poly-point.php
 // aka idk how this works go on their website to find out
 func PtPolyCollision(pt *Point, poly *Shape) bool {
-	collision := false
-	next := 0
-	for i := 0; i < len(poly.Pts); i++ {
-		next = i + 1
-		if next == len(poly.Pts) {
-			next = 0
-		}
-		Vc := poly.Pts[i]
-		Vn := poly.Pts[next]
-		if (Vc.Y() > pt.Y()) != (Vn.Y() > pt.Y()) && pt.X() < (Vn.X()-Vc.X())*(pt.Y()-Vc.Y())/(Vn.Y()-Vc.Y())+Vc.X() {
-			collision = !collision
-		}
-	}
-	return collision
+	return PtInPolygon(pt, poly.Pts)
 }
 
-func TextToShape(f *Font, s string) *Shape {
-	text := NewShape(mgl32.Ident4(), program)
-	offset := P(1, 0, 0)
-	var prevI sfnt.GlyphIndex
-	for i := len(s) - 1; i > -1; i-- {
-		r := rune(s[i])
-		switch r {
-		case ' ':
-			offset = offset.SetP(offset.X()+1, 0, 0)
-		default:
-			text.Pts = append(text.Pts, offset.MassOffset(f.GlyphMap[r].Pts...)...)
-			glyph := &sfnt.Buffer{}
-			I, err := f.TtfFont.GlyphIndex(glyph, r)
-			orDie(err)
-			// Scale the offset from truetype coords to opengl coords
-			kerning, err := f.TtfFont.Kern(glyph, prevI, I, f.OgScale, font.HintingNone)
-			//	orDie(err)
-			bound, err := f.TtfFont.Bounds(glyph, f.OgScale, font.HintingNone)
-			//	orDie(err)
-			offX := float32(kerning.Round())
-			offX /= float32(bound.Max.X.Round())
-			prevI = I
-			// Apply the offset
-			offset = offset.SetP(offset.X()+1, 0, 0)
+// Even-odd test of pt against the rings on the XY plane, the first one being
+// the outline and the rest holes in it, so that points in a hole are outside
+func PtInPolygon(pt *Point, rings ...[]*Point) bool {
+	collision := false
+	for _, ring := range rings {
+		next := 0
+		for i := 0; i < len(ring); i++ {
+			next = i + 1
+			if next == len(ring) {
+				next = 0
+			}
+			Vc := ring[i]
+			Vn := ring[next]
+			if (Vc.Y() > pt.Y()) != (Vn.Y() > pt.Y()) && pt.X() < (Vn.X()-Vc.X())*(pt.Y()-Vc.Y())/(Vn.Y()-Vc.Y())+Vc.X() {
+				collision = !collision
+			}
 		}
 	}
-	reScaleFac := 1 / (offset.X() - 1)
-	text = text.ReScale(reScaleFac, reScaleFac, 1)
-	// Using LINES instead of LINE_LOOP to prevent lines joining between runes
-	text.SetTypes(gl.LINES)
-	return text
+	return collision
 }
 
 func orDie(err error) {
@@ -201,15 +251,9 @@ func UnProject(viewM, projM mgl32.Mat4) mgl32.Mat4 {
 	return projM.Mul4(viewM).Inv()
 }
 
-func UpdateView(lookingAt, eyePosition mgl32.Vec3) {
-	viewMat = mgl32.LookAtV(
-		lookingAt,
-		eyePosition,
-		mgl32.Vec3{0, 1, 0},
-	)
-	UpdateUniformMat4fv("view", program, &viewMat[0])
-}
-
+// Moller-Trumbore intersection of a ray with a triangle, ray[0] is the origin of
+// the ray and ray[1] its direction, NOT a second point on it
+// Hits behind the origin don't count, both sides of the triangle do
 func RayTriangleCollision(ray [2]*mgl32.Vec3, triangle [3]*mgl32.Vec3) (bool, mgl32.Vec3) {
 	Epsl := mgl32.Epsilon
 	Null := mgl32.Vec3{mgl32.NaN, mgl32.NaN, mgl32.NaN}
@@ -241,6 +285,37 @@ func RayTriangleCollision(ray [2]*mgl32.Vec3, triangle [3]*mgl32.Vec3) (bool, mg
 	}
 }
 
+// Slab test of the ray starting at origin going along dir against the box
+// from min to max, returns how far along dir the ray enters the box
+// The distance is 0 if the origin is inside the box
+func RayBoxCollision(origin, dir, min, max mgl32.Vec3) (float32, bool) {
+	tNear, tFar := float32(0), float32(math.Inf(1))
+	for i := 0; i < 3; i++ {
+		if dir[i] == 0 {
+			// Parallel to this slab, it has to start between its planes
+			if origin[i] < min[i] || origin[i] > max[i] {
+				return 0, false
+			}
+			continue
+		}
+		t1 := (min[i] - origin[i]) / dir[i]
+		t2 := (max[i] - origin[i]) / dir[i]
+		if t1 > t2 {
+			t1, t2 = t2, t1
+		}
+		if t1 > tNear {
+			tNear = t1
+		}
+		if t2 < tFar {
+			tFar = t2
+		}
+		if tNear > tFar {
+			return 0, false
+		}
+	}
+	return tNear, true
+}
+
 func LoadBvg(path string) *bvg.Bvg {
 	bvgBytes, err := ioutil.ReadFile(path)
 	orDie(err)
@@ -249,6 +324,14 @@ func LoadBvg(path string) *bvg.Bvg {
 	return LoadedBvg
 }
 
+// gl.Ptr panics on empty slices, this gives nil for them instead
+func bytesPtr(b []byte) unsafe.Pointer {
+	if len(b) == 0 {
+		return nil
+	}
+	return gl.Ptr(b)
+}
+
 func Float32SlicetoBytes(x []float32) []byte {
 	byteSlice := make([]byte, len(x)*4)
 	for i, f := range x {
@@ -275,7 +358,7 @@ func BvgS(b *bvg.Bvg) []Drawable {
 	// Sum of number of all the individual shapes in b
 	// +2 for lines and points
 	index := 0
-	shapes := make([]Drawable, len(b.Bezs)+len(b.Circles)+len(b.LineStrips)+len(b.Polys)+2)
+	shapes := make([]Drawable, len(b.Bezs)+len(b.Circles)+len(b.LineStrips)+len(b.Lines)+len(b.Polys)+2)
 	for _, v := range b.Circles {
 		shapes[index] = Drawable(NewCircle(BvgP(v.P), float32(v.R), float32(v.T), true, mgl32.Ident4()))
 		fmt.Printf("%+v", v)
@@ -283,19 +366,27 @@ func BvgS(b *bvg.Bvg) []Drawable {
 
 	}
 	for _, v := range b.Lines {
-		shapes[index] = Drawable(NewShape(mgl32.Ident4(), program, BvgP(v.P1), BvgP(v.P2)))
+		shapes[index] = Drawable(NewShape(mgl32.Ident4(), DefaultMaterial, BvgP(v.P1), BvgP(v.P2)))
 		shapes[index].(*Shape).SetTypes(gl.LINES)
 		index++
 	}
+	for _, v := range b.Polys {
+		pts := make([]*Point, len(v.Pts))
+		for i, p := range v.Pts {
+			pts[i] = BvgP(p)
+		}
+		shapes[index] = Drawable(NewPolygon(mgl32.Ident4(), DefaultMaterial, pts))
+		index++
+	}
 	/*
 		for _, v := range b.LineStrips {
-			shapes[index] = Drawable(NewShape(mgl32.Mat4, program, ))
+			shapes[index] = Drawable(NewShape(mgl32.Mat4, DefaultMaterial, ))
 		}
 	*/
 	return shapes
 }
 func DecodeTanishqsWierdFormat(path string) *Shape {
-	points := NewShape(mgl32.Ident4(), program)
+	points := NewShape(mgl32.Ident4(), DefaultMaterial)
 	wierdFile, err := ioutil.ReadFile(path)
 	orDie(err)
 	var floatsStr [3]string
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func TestRayTriangleCollision(t *testing.T) {
+	// Right triangle in the z = 0 plane
+	tri := [3]mgl32.Vec3{{0, 0, 0}, {2, 0, 0}, {0, 2, 0}}
+	down := mgl32.Vec3{0, 0, -1}
+	cases := []struct {
+		name        string
+		origin, dir mgl32.Vec3
+		hit         bool
+		at          mgl32.Vec3
+	}{
+		{"hit", mgl32.Vec3{0.5, 0.5, 3}, down, true, mgl32.Vec3{0.5, 0.5, 0}},
+		{"hit from below", mgl32.Vec3{0.5, 0.5, -3}, mgl32.Vec3{0, 0, 1}, true, mgl32.Vec3{0.5, 0.5, 0}},
+		{"unnormalized direction", mgl32.Vec3{0.5, 0.5, 3}, mgl32.Vec3{0, 0, -10}, true, mgl32.Vec3{0.5, 0.5, 0}},
+		{"slanted hit", mgl32.Vec3{0, 0, 1}, mgl32.Vec3{0.5, 0.5, -1}, true, mgl32.Vec3{0.5, 0.5, 0}},
+		{"miss", mgl32.Vec3{1.5, 1.5, 3}, down, false, mgl32.Vec3{}},
+		{"miss past the right angle", mgl32.Vec3{-0.5, 0.5, 3}, down, false, mgl32.Vec3{}},
+		{"edge graze", mgl32.Vec3{1, 0, 3}, down, true, mgl32.Vec3{1, 0, 0}},
+		{"hypotenuse graze", mgl32.Vec3{1, 1, 3}, down, true, mgl32.Vec3{1, 1, 0}},
+		{"vertex graze", mgl32.Vec3{0, 0, 3}, down, true, mgl32.Vec3{0, 0, 0}},
+		{"parallel above", mgl32.Vec3{0.5, 0.5, 1}, mgl32.Vec3{1, 0, 0}, false, mgl32.Vec3{}},
+		{"parallel in the plane", mgl32.Vec3{-1, 0.5, 0}, mgl32.Vec3{1, 0, 0}, false, mgl32.Vec3{}},
+		{"behind the origin", mgl32.Vec3{0.5, 0.5, -3}, down, false, mgl32.Vec3{}},
+		{"origin on the triangle", mgl32.Vec3{0.5, 0.5, 0}, down, false, mgl32.Vec3{}},
+	}
+	for _, c := range cases {
+		hit, at := RayTriangleCollision([2]*mgl32.Vec3{&c.origin, &c.dir},
+			[3]*mgl32.Vec3{&tri[0], &tri[1], &tri[2]})
+		if hit != c.hit {
+			t.Errorf("%s: hit = %v, want %v", c.name, hit, c.hit)
+			continue
+		}
+		if hit && !at.ApproxEqual(c.at) {
+			t.Errorf("%s: hit at %v, want %v", c.name, at, c.at)
+		}
+	}
+}